@@ -9,17 +9,21 @@
 window.onload = function() {
     connectWebSocket()
     function connectWebSocket() {
-        socket = new WebSocket(`ws://localhost:${port}/startport`);
+        socket = new WebSocket(`${location.protocol === "https:" ? "wss" : "ws"}://${location.host}/startport`);
 
         socket.onopen = () => {
             console.log("✅ WebSocket подключён");
 
             // Пример регистрации страницы
-            socket.send(JSON.stringify({ type: "register", screen: "game" }));
+            socket.send(JSON.stringify({ type: "register", screen: "game", slot: new URLSearchParams(location.search).get("slot") || "" }));
         };
 
         socket.onmessage = (event) => {
             const data = JSON.parse(event.data);
+            if (data.type === "reload") {
+                location.reload();
+                return;
+            }
             if (data.type === "update" && data.screen === "game") {
                 if (data.payload.game !== lastGame) {
                     document.getElementById('game').textContent = data.payload.game;
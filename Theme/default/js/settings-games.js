@@ -15,12 +15,13 @@ function updateProcessInfo() {
     }
 }
 // Функция удаления (заглушка, нужно реализовать серверную часть)
-function deleteTemplate(processName) {
+function deleteTemplate(id, processName) {
     if (confirm(confirmText)) {
         const message = {
             type: "delete",
             dataType: "deleteGameTemplate",
             screen: "settings-games",
+            id: id,
             processName: processName,
         };
         socket.send(JSON.stringify(message));
@@ -32,7 +33,7 @@ window.onload = function() {
     connectWebSocket()
 
     function connectWebSocket() {
-        socket = new WebSocket(`ws://localhost:`+port+`/startport`);
+        socket = new WebSocket(`${location.protocol === "https:" ? "wss" : "ws"}://${location.host}/startport`);
 
         socket.onopen = () => {
             console.log("✅ WebSocket подключён");
@@ -43,6 +44,10 @@ window.onload = function() {
 
         socket.onmessage = (event) => {
             const data = JSON.parse(event.data);
+            if (data.type === "reload") {
+                location.reload();
+                return;
+            }
             switch (data.type) {
                 case "gameTemplates":
                     templates = data.payload
@@ -60,6 +65,10 @@ window.onload = function() {
                 case "refresh":
                     socket.send(JSON.stringify({ type: "get_data", screen: "settings-games", dataType: "gameTemplates" }));
                     break;
+                case "uploadError":
+                case "templateError":
+                    alert(data.payload);
+                    break;
             }
         };
 
@@ -91,7 +100,10 @@ window.onload = function() {
         processes.forEach(proc => {
             let option = document.createElement('option');
             option.value = proc.pid;
-            option.text = proc.name;
+            option.text = proc.title ? proc.name + ' - ' + proc.title : proc.name;
+            let label = document.createElement('span');
+            label.textContent = option.text;
+            option.dataset.html = (proc.icon ? '<img src="' + proc.icon + '" width="16" height="16" class="process-icon"> ' : '') + label.innerHTML;
             select.appendChild(option);
         });
         new SlimSelect({
@@ -114,9 +126,10 @@ window.onload = function() {
             row.innerHTML = `
       <td>${tmpl.process_name}</td>
       <td>${tmpl.window_title}</td>
+      <td>${tmpl.priority || 0}</td>
       <td>${tmpl.named_titles ? '<img src="/thumbnails/' + tmpl.named_titles + '" width="50">' : ''}</td>
       <td>${tmpl.named_boxarts ? '<img src="/thumbnails/' + tmpl.named_boxarts + '" width="50">' : ''}</td>
-      <td class="last-td"><span class="submit-button" onclick="deleteTemplate('${tmpl.process_name}')">${buttonDeleteText}</span></td>
+      <td class="last-td"><span class="submit-button" onclick="deleteTemplate('${tmpl.id}', '${tmpl.process_name}')">${buttonDeleteText}</span></td>
       `;
             tbody.appendChild(row);
         });
@@ -7,12 +7,16 @@
 // THERE'S NOTHING TO CHANGE!
 // THIS CODE IS NEEDED FOR THE SYSTEM TO WORK!
 window.onload = function() {
-    socket = new WebSocket(`ws://localhost:${port}/startport`);
+    socket = new WebSocket(`${location.protocol === "https:" ? "wss" : "ws"}://${location.host}/startport`);
     socket.onopen = () => {
-        socket.send(JSON.stringify({ type: "register", screen: "system" }));
+        socket.send(JSON.stringify({ type: "register", screen: "system", slot: new URLSearchParams(location.search).get("slot") || "" }));
     };
     socket.onmessage = (event) => {
         const data = JSON.parse(event.data);
+        if (data.type === "reload") {
+            location.reload();
+            return;
+        }
         if (data.type === "update" && data.screen === "system") {
             if (data.payload.console !== lastSystem) {
                 document.getElementById('system').textContent = data.payload.console;
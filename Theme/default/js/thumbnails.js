@@ -90,20 +90,25 @@ window.onload = function() {
 
 
     function connectWebSocket() {
-        socket = new WebSocket(`ws://localhost:${port}/startport`);
+        socket = new WebSocket(`${location.protocol === "https:" ? "wss" : "ws"}://${location.host}/startport`);
 
         socket.onopen = () => {
             console.log("✅ WebSocket подключён");
 
             // Пример регистрации страницы
-            socket.send(JSON.stringify({ type: "register", screen: "thumbnails" }));
+            socket.send(JSON.stringify({ type: "register", screen: "thumbnails", slot: new URLSearchParams(location.search).get("slot") || "" }));
         };
 
         socket.onmessage = (event) => {
             const data = JSON.parse(event.data);
+            if (data.type === "reload") {
+                location.reload();
+                return;
+            }
             if (data.type === "update" && data.screen === "thumbnails") {
                 if (lastGame !==data.payload.game){
-                    lastThumbnails = data.payload.paths || [];
+                    const type = new URLSearchParams(location.search).get("type");
+                    lastThumbnails = (type ? (data.payload.types || {})[type] : data.payload.paths) || [];
                     currentThumbnailIndex = 0;
                     update(lastThumbnails,currentThumbnailIndex, data.payload.width, data.payload.height);
                 }
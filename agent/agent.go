@@ -0,0 +1,46 @@
+// Package agent connects a TrackGameName on the gaming PC to the one on the
+// streaming PC. The agent runs detection where the games are and pushes the
+// state and the thumbnails of the current game; the receiving side shows them
+// in its widgets while the agent is online.
+package agent
+
+import "time"
+
+// Path is the WebSocket endpoint agents connect to.
+const Path = "/api/v1/agent"
+
+const (
+	// PingInterval is how often an idle agent says it is still there.
+	PingInterval = 10 * time.Second
+	// Timeout is how long either side waits before it treats the other as
+	// gone.
+	Timeout = 3 * PingInterval
+)
+
+// Message types.
+const (
+	TypeHello     = "hello"
+	TypeState     = "state"
+	TypeThumbnail = "thumbnail"
+	TypePing      = "ping"
+)
+
+// Message is one JSON frame sent by an agent. Hello comes first, thumbnails
+// of a new game are sent before its state.
+type Message struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	State   *State `json:"state,omitempty"`
+	// Path is where a thumbnail lives under thumbnails_path, with forward
+	// slashes, e.g. "Nintendo - SNES/Named_Titles/Game.png".
+	Path string `json:"path,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// State is what the agent's detection sees.
+type State struct {
+	Game             string `json:"game"`
+	System           string `json:"system"`
+	RetroarchRunning bool   `json:"retroarch_running"`
+}
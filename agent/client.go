@@ -0,0 +1,283 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	// maxThumbnailSize matches what the receiving side accepts.
+	maxThumbnailSize = 5 << 20
+)
+
+var errReconnect = errors.New("agent settings changed")
+
+// Client pushes the state of a tracker to the TrackGameName at agent_url.
+type Client struct {
+	tracker *tracker.Tracker
+	version string
+	changed chan struct{}
+	// reconnect asks the current session to end after the agent settings changed
+	reconnect chan struct{}
+}
+
+// New returns a client for t. It starts listening to t right away, so no
+// change is missed before Run connects.
+func New(t *tracker.Tracker, version string) *Client {
+	c := &Client{tracker: t, version: version, changed: make(chan struct{}, 1), reconnect: make(chan struct{}, 1)}
+	t.Subscribe("agent", func(ev tracker.Event) {
+		switch ev.Kind {
+		case tracker.GameStarted, tracker.GameChanged, tracker.GameStopped, tracker.RetroarchChanged:
+			notify(c.changed)
+		case tracker.ConfigChanged:
+			cfg, old := ev.Config, ev.Previous
+			if cfg.AgentURL != old.AgentURL || cfg.AgentToken != old.AgentToken || cfg.AgentCAFile != old.AgentCAFile || cfg.AgentSlot != old.AgentSlot {
+				notify(c.reconnect)
+			}
+		}
+	})
+	return c
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Run keeps connected to agent_url until ctx is done, reconnecting with a
+// growing pause after errors.
+func (c *Client) Run(ctx context.Context) {
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		cfg := c.tracker.Config()
+		if cfg.AgentURL == "" || cfg.AgentToken == "" {
+			// agent_url стёрли на ходу: ждём, пока его снова зададут
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.reconnect:
+				continue
+			}
+		}
+		started := time.Now()
+		err := c.session(ctx, cfg)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute || errors.Is(err, errReconnect) {
+			backoff = minBackoff
+		}
+		if errors.Is(err, errReconnect) {
+			continue
+		}
+		slog.Warn("Agent connection lost", "url", cfg.AgentURL, "err", err, "retry", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session sends the state over one connection until it fails or ctx is done.
+func (c *Client) session(ctx context.Context, cfg config.Config) error {
+	endpoint, err := websocketURL(cfg.AgentURL)
+	if err != nil {
+		return err
+	}
+	if cfg.AgentSlot != "" {
+		endpoint += "?slot=" + url.QueryEscape(cfg.AgentSlot)
+	}
+	tlsConfig, err := clientTLS(cfg)
+	if err != nil {
+		return err
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: Timeout, TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	header := http.Header{"Authorization": {"Bearer " + cfg.AgentToken}}
+	conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return errors.New("agent_token was rejected")
+		}
+		if resp != nil && resp.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("agent_slot %q was rejected, use letters, digits, '.', '-' and '_'", cfg.AgentSlot)
+		}
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return errors.New("the other side does not accept agents, set agent_token there")
+		}
+		return err
+	}
+	defer conn.Close()
+	slog.Info("Agent connected", "url", endpoint)
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+
+	// читаем только чтобы заметить закрытие соединения
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	write := func(msg Message) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(Timeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(msg)
+	}
+	name, _ := os.Hostname()
+	if err := write(Message{Type: TypeHello, Name: name, Version: c.version}); err != nil {
+		return err
+	}
+
+	var sentGame string
+	push := func() error {
+		state := c.tracker.LocalState()
+		if key := state.System + "\x00" + state.Game; state.Game != "" && key != sentGame {
+			for _, msg := range c.thumbnails(state) {
+				if err := write(msg); err != nil {
+					return err
+				}
+			}
+			sentGame = key
+		}
+		return write(Message{Type: TypeState, State: &State{
+			Game:             state.Game,
+			System:           state.System,
+			RetroarchRunning: state.RetroarchRunning,
+		}})
+	}
+	if err := push(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			return err
+		case <-c.reconnect:
+			slog.Info("Agent settings changed, reconnecting")
+			return errReconnect
+		case <-c.changed:
+			if err := push(); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := write(Message{Type: TypePing}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// thumbnails reads the images of the game in state from thumbnails_path and
+// names them after the game as it is shown.
+func (c *Client) thumbnails(state tracker.State) []Message {
+	cfg := c.tracker.Config()
+	if cfg.ThumbnailsPath == "" || state.System == "" {
+		return nil
+	}
+	var msgs []Message
+	fsys := c.tracker.FS()
+	query := retroarch.QueryFromHistory(fsys, cfg.RetroarchPath, state.System, state.Game)
+	// все типы: какие показывать, решает принимающая сторона
+	kinds := retroarch.ThumbnailFolders(retroarch.ThumbnailTypes)
+	for _, rel := range retroarch.FindThumbnails(fsys, cfg.ThumbnailsPath, query, kinds) {
+		path := filepath.Join(cfg.ThumbnailsPath, filepath.FromSlash(rel))
+		// на принимающей стороне файл ищется по показанному имени игры
+		parts := strings.Split(rel, "/")
+		rel = fmt.Sprintf("%s/%s/%s.png", parts[0], parts[1], retroarch.ThumbnailName(state.Game))
+		data, err := fsys.ReadFile(path)
+		if err != nil {
+			slog.Warn("Error reading thumbnail", "path", path, "err", err)
+			continue
+		}
+		if len(data) > maxThumbnailSize {
+			slog.Warn("Thumbnail is too large to send", "path", path, "size", len(data))
+			continue
+		}
+		msgs = append(msgs, Message{Type: TypeThumbnail, Path: rel, Data: data})
+	}
+	return msgs
+}
+
+// websocketURL turns agent_url, the address of the other TrackGameName as
+// opened in a browser, into the URL of its agent endpoint.
+func websocketURL(agentURL string) (string, error) {
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid agent_url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("agent_url must start with http:// or https://, got %q", agentURL)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("agent_url %q has no host", agentURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + Path
+	u.RawQuery, u.Fragment = "", ""
+	return u.String(), nil
+}
+
+// ValidURL reports whether agent_url can be connected to.
+func ValidURL(agentURL string) bool {
+	_, err := websocketURL(agentURL)
+	return err == nil
+}
+
+// clientTLS trusts the certificate in agent_ca_file in addition to the system
+// ones, e.g. the self-signed certificate of the streaming PC.
+func clientTLS(cfg config.Config) (*tls.Config, error) {
+	if cfg.AgentCAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(cfg.AgentCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading agent_ca_file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("agent_ca_file %s has no PEM certificate", cfg.AgentCAFile)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
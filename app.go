@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/agent"
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/detection"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/logging"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/outputs"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/tracker"
+	"WatchdogRetroArch/tray"
+	"WatchdogRetroArch/web"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var appVersion = "dev-build"
+
+// app wires the packages of a running tracker together.
+type app struct {
+	tracker      *tracker.Tracker
+	metrics      *metrics.Metrics
+	server       *web.Server
+	outputs      *outputs.Writer
+	watcher      *detection.Watcher
+	files        *fileWatcher
+	dirs         web.Dirs
+	translations i18n.Translations
+	profiles     config.Profiles
+
+	mu         sync.RWMutex
+	configPath string
+	profile    string
+}
+
+// loadConfig reads the config.ini at path with the command-line overrides on
+// top. A failed migration is returned separately; the settings are still usable.
+func loadConfig(path string) (config.Config, error, error) {
+	cfg, migrateErr, err := readConfig(path)
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	logging.Apply(cfg, cliOpts.logLevel != "")
+	return cfg, migrateErr, nil
+}
+
+// readConfig is loadConfig without applying the log settings, for reloads
+// that may still reject the result.
+func readConfig(path string) (config.Config, error, error) {
+	cfg, migrateErr, err := config.Load(path)
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	applyOverrides(&cfg)
+	return cfg, migrateErr, nil
+}
+
+// initApp prepares the save folder, theme and translations and returns the
+// save path. It exits the program if any of them is unusable.
+func initApp(cfg *config.Config, appDir string) (string, web.Dirs, i18n.Translations) {
+	savePath, err := resolveSavePath(*cfg, appDir)
+	if err != nil {
+		slog.Error("Error resolving config folder", "err", err)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(savePath, 0755); err != nil {
+		slog.Error("Error creating save_path folder", "err", err)
+		os.Exit(1)
+	}
+
+	// без своих папок берём те, что лежат рядом с программой
+	dirs := web.Dirs{Save: savePath}
+	dirs.Systems = config.ResourcePath(savePath, "systems")
+	if err := os.MkdirAll(dirs.Systems, 0755); err != nil {
+		slog.Error("Error creating systems folder", "err", err)
+		os.Exit(1)
+	}
+
+	dirs.Theme = config.ResourcePath(savePath, "Theme")
+	if err := os.MkdirAll(filepath.Join(dirs.Theme, "default"), 0755); err != nil {
+		slog.Error("Error creating Theme/default folder", "err", err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(filepath.Join(dirs.Theme, cfg.Theme)); os.IsNotExist(err) {
+		slog.Warn("Theme not found, falling back to default", "theme", cfg.Theme)
+		cfg.Theme = "default"
+	}
+	if _, err := web.ParseTheme(dirs.Theme, cfg.Theme); err != nil {
+		slog.Error("Error loading theme, falling back to default", "theme", cfg.Theme, "err", err)
+		cfg.Theme = "default"
+		if _, err := web.ParseTheme(dirs.Theme, cfg.Theme); err != nil {
+			slog.Error("Error loading default theme", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	dirs.Lang = config.ResourcePath(appDir, "lang")
+	if err := os.MkdirAll(dirs.Lang, 0755); err != nil {
+		slog.Error("Error creating lang folder", "err", err)
+		os.Exit(1)
+	}
+
+	translations, _, err := i18n.Load(dirs.Lang, cfg.Language)
+	if err != nil {
+		slog.Error("Error loading translations", "err", err)
+		cfg.Language = "en"
+		translations, _, err = i18n.Load(dirs.Lang, cfg.Language)
+		if err != nil {
+			slog.Error("Error loading default translations", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	return savePath, dirs, translations
+}
+
+// resolveSavePath returns the folder of games.json for cfg: save_path, or
+// appDir when it is empty.
+func resolveSavePath(cfg config.Config, appDir string) (string, error) {
+	if cfg.SavePath != "" {
+		return cfg.SavePath, nil
+	}
+	return filepath.Abs(appDir)
+}
+
+func newApp(cfg config.Config, configPath string, profiles config.Profiles, profile string) *app {
+	savePath, dirs, translations := initApp(&cfg, profiles.Dir)
+	return &app{
+		tracker:      tracker.New(cfg, savePath, fsutil.OS),
+		metrics:      metrics.New(),
+		files:        newFileWatcher(),
+		dirs:         dirs,
+		translations: translations,
+		profiles:     profiles,
+		configPath:   configPath,
+		profile:      profile,
+	}
+}
+
+// run starts the web server, detection and the tray icon and returns when
+// the tray is closed.
+func (a *app) run() {
+	slog.Info("TrackGameName started", "version", appVersion)
+
+	life := newLifecycle()
+	a.watcher = detection.NewWatcher(250*time.Millisecond, a.metrics)
+	life.Go(a.watcher.Run)
+
+	if err := a.tracker.LoadTemplates(); err != nil {
+		slog.Error("Error loading game templates", "err", err)
+	}
+
+	cfg := a.tracker.Config()
+	if err := setAutorun(cfg.Autorun, "TrackGameName"); err != nil {
+		slog.Error("Error setting autorun at startup", "err", err)
+	}
+
+	a.outputs = outputs.New(a.tracker, a.metrics)
+	server, err := web.New(web.Options{
+		Tracker:    a.tracker,
+		Metrics:    a.metrics,
+		Dirs:       a.dirs,
+		Version:    appVersion,
+		SaveConfig: a.saveConfig,
+	})
+	if err != nil {
+		slog.Error("Error loading theme", "err", err)
+		os.Exit(1)
+	}
+	a.server = server
+	a.tracker.Subscribe("config", a.onConfigChanged)
+	if !config.IsLocalOnly(cfg) && cfg.AdminToken == "" {
+		slog.Warn("The web server is reachable from the network without admin_token, anyone can change the settings", "bind_address", cfg.BindAddress)
+	}
+	server.Start()
+	life.tracker, life.server, life.outputs = a.tracker, server, a.outputs
+
+	life.Go(func(ctx context.Context) { a.watchFiles(ctx, 2*time.Second) })
+	go life.quitOnSignal()
+
+	slog.Info("RetroArch history", "path", retroarch.HistoryPath(cfg.RetroarchPath))
+	var source detection.Source = detection.LiveSource{Watcher: a.watcher, FS: a.tracker.FS()}
+	if cliOpts.record != "" {
+		recorder, err := detection.NewRecorder(source, cliOpts.record)
+		if err != nil {
+			slog.Error("Error creating detection recording", "path", cliOpts.record, "err", err)
+		} else {
+			slog.Info("Recording detection", "path", cliOpts.record)
+			life.recorder = recorder
+			source = recorder
+		}
+	}
+	life.Go(detection.NewDetector(a.tracker, source, detection.SystemClock{}, a.metrics).Run)
+	if cfg.AgentURL != "" {
+		if cfg.AgentToken == "" {
+			slog.Warn("agent_url is set without agent_token, not sending to the other side", "url", cfg.AgentURL)
+		} else {
+			slog.Info("Sending detection to another TrackGameName", "url", cfg.AgentURL)
+			life.Go(agent.New(a.tracker, appVersion).Run)
+		}
+	}
+
+	a.mu.RLock()
+	profile := a.profile
+	a.mu.RUnlock()
+	tray.Run(tray.Options{
+		Tracker:       a.tracker,
+		T:             a.translations,
+		Profiles:      a.profiles.List(),
+		ActiveProfile: profile,
+		SwitchProfile: a.switchProfile,
+	}, life.shutdown)
+}
+
+// currentConfigPath returns the config.ini of the active profile.
+func (a *app) currentConfigPath() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.configPath
+}
+
+// saveConfig writes settings changed on the settings page, leaving keys set
+// by command-line flags alone.
+func (a *app) saveConfig(cfg config.Config) error {
+	var keep []string
+	if cliOpts.savePath != "" {
+		keep = append(keep, "save_path")
+	}
+	if cliOpts.port != 0 {
+		keep = append(keep, "web_port")
+	}
+	path := a.currentConfigPath()
+	return a.files.write(path, func() error { return config.Save(path, cfg, keep...) })
+}
+
+// onConfigChanged applies the settings that live outside the tracker.
+func (a *app) onConfigChanged(ev tracker.Event) {
+	if ev.Kind != tracker.ConfigChanged {
+		return
+	}
+	logging.Apply(ev.Config, cliOpts.logLevel != "")
+	if ev.Config.Autorun != ev.Previous.Autorun {
+		if err := setAutorun(ev.Config.Autorun, "TrackGameName"); err != nil {
+			slog.Error("Error updating autorun", "err", err)
+		}
+	}
+}
+
+// switchProfile makes name the active profile and reloads its settings.
+// games.json and the output files stay in the save_path chosen at startup,
+// so a profile with another save_path needs a restart.
+func (a *app) switchProfile(name string) error {
+	path := a.profiles.Path(name)
+	if !fsutil.Exists(path) {
+		return fmt.Errorf("profile %s not found", name)
+	}
+	cfg, _, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	savePath, err := resolveSavePath(cfg, a.profiles.Dir)
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(savePath) != filepath.Clean(a.tracker.SavePath()) {
+		return fmt.Errorf("profile %s uses save_path %s, restart the program with -profile %s to switch to it", name, savePath, name)
+	}
+	a.mu.Lock()
+	previousPath, previousProfile := a.configPath, a.profile
+	a.configPath, a.profile = path, name
+	a.mu.Unlock()
+
+	if err := a.reloadConfig(); err != nil {
+		a.mu.Lock()
+		a.configPath, a.profile = previousPath, previousProfile
+		a.mu.Unlock()
+		return err
+	}
+	if err := a.profiles.SaveActive(name); err != nil {
+		slog.Error("Error saving active profile", "err", err)
+	}
+	slog.Info("Switched profile", "profile", name, "path", path)
+	go a.server.NotifyReload()
+	return nil
+}
+
+func setAutorun(enable bool, appName string) error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Run`, registry.ALL_ACCESS)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := key.Close(); err != nil {
+			slog.Warn("failed close", "err", err)
+		}
+	}()
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if enable {
+		err = key.SetStringValue(appName, exePath)
+		if err != nil {
+			return err
+		}
+		slog.Info("Program added to autorun", "path", exePath)
+	} else {
+		err = key.DeleteValue(appName)
+		if err != nil && !errors.Is(err, registry.ErrNotExist) {
+			return err
+		}
+		slog.Info("Program removed from autorun")
+	}
+	return nil
+}
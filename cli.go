@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/detection"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/logging"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+	"WatchdogRetroArch/web"
+
+	"gopkg.in/ini.v1"
+)
+
+// cliOptions are the global command-line flags. Non-zero values override
+// config.ini for this run and are never written back to it.
+type cliOptions struct {
+	savePath string
+	port     int
+	logLevel string
+	record   string
+}
+
+var cliOpts cliOptions
+
+const cliUsage = `Usage: TrackGameName [flags] [command]
+
+Commands:
+  run                          start the tracker with tray icon and web server (default)
+  status                       show what a running instance is tracking
+  doctor                       check the configuration and exit
+  templates list               list game templates
+  templates add -process NAME  add a game template (see "templates add -h")
+  templates remove ID|PROCESS  remove a game template
+  templates export FILE [ID..] write templates and their thumbnails to a pack
+  templates import FILE        add templates from a pack (see "templates import -h")
+  config get KEY               print a config.ini value
+  config set KEY VALUE [..]    change config.ini values, checked like the settings page
+  stats export [FILE]          write the counters of a running instance (see "stats export -h")
+  replay FILE                  replay a -record file and print the game timeline
+
+Flags:
+`
+
+func main() {
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCLI parses flags, dispatches to a command and returns the exit code.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("TrackGameName", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFlag, profileFlag := "", ""
+	fs.StringVar(&configFlag, "config", "", "path to config.ini (default: "+config.ConfigEnvVar+", the program folder or the user config folder)")
+	fs.StringVar(&profileFlag, "profile", "", "profile to use from the profiles folder (default: "+config.ProfileEnvVar+" or the last one chosen)")
+	fs.StringVar(&cliOpts.savePath, "save-path", "", "override save_path from config.ini")
+	fs.IntVar(&cliOpts.port, "port", 0, "override web_port from config.ini")
+	fs.StringVar(&cliOpts.logLevel, "log-level", "", "minimum log level: debug, info, warn or error (default: log_level from config.ini)")
+	fs.StringVar(&cliOpts.record, "record", "", "write every detection pass to this file, for the replay command")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, cliUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	level := slog.LevelInfo
+	if cliOpts.logLevel != "" {
+		var err error
+		if level, err = logging.ParseLevel(cliOpts.logLevel); err != nil {
+			fmt.Fprintf(stderr, "invalid -log-level %q: use debug, info, warn or error\n", cliOpts.logLevel)
+			return 2
+		}
+	}
+
+	command, rest := "run", []string(nil)
+	if fs.NArg() > 0 {
+		command, rest = fs.Arg(0), fs.Args()[1:]
+	}
+	// replay не трогает config.ini и журнал; по умолчанию выводим только предупреждения
+	if command == "replay" {
+		if cliOpts.logLevel == "" {
+			level = slog.LevelWarn
+		}
+		slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})))
+		return runReplayCommand(rest, stdout, stderr)
+	}
+
+	basePath := config.ResolvePath(configFlag)
+	appDir := filepath.Dir(basePath)
+
+	if err := logging.Setup(filepath.Join(appDir, "trackgamename.log"), level); err != nil {
+		fmt.Fprintf(stderr, "Error opening log file: %v\n", err)
+		return 1
+	}
+	defer logging.Close()
+
+	profiles := config.Profiles{Dir: appDir, Base: basePath}
+	profile := profiles.Select(profileFlag)
+	configPath := profiles.Path(profile)
+
+	// config get/set работают с файлом напрямую и не должны его создавать или мигрировать
+	if command == "config" {
+		return runConfigCommand(configPath, appDir, rest, stdout, stderr)
+	}
+
+	cfg, migrateErr, err := loadConfig(configPath)
+	if err != nil {
+		slog.Error("Error loading config", "err", err)
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	switch command {
+	case "run":
+		a := newApp(cfg, configPath, profiles, profile)
+		if migrateErr != nil {
+			a.tracker.AddFileError(configPath, migrateErr)
+		}
+		a.run()
+		return 0
+	case "doctor":
+		_, dirs, _ := initApp(&cfg, appDir)
+		return runDoctor(stdout, cfg, dirs, configPath, profile)
+	case "status":
+		return runStatusCommand(cfg, stdout, stderr)
+	case "templates":
+		return runTemplatesCommand(cfg, appDir, rest, stdout, stderr)
+	case "stats":
+		return runStatsCommand(cfg, rest, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n", command)
+		fs.Usage()
+		return 2
+	}
+}
+
+// applyOverrides puts command-line flags on top of values read from config.ini.
+func applyOverrides(cfg *config.Config) {
+	if cliOpts.savePath != "" {
+		cfg.SavePath = cliOpts.savePath
+	}
+	if cliOpts.port != 0 {
+		cfg.WebPort = cliOpts.port
+	}
+}
+
+// runDoctor prints the diagnostics checks and returns 1 if any of them failed.
+func runDoctor(out io.Writer, cfg config.Config, dirs web.Dirs, configPath, profile string) int {
+	code := 0
+	fmt.Fprintf(out, "config: %s (profile %s)\n", configPath, profile)
+	for _, res := range web.RunChecks(cfg, dirs, false) {
+		fmt.Fprintf(out, "[%s] %s: %s\n", strings.ToUpper(res.Status), strings.TrimPrefix(res.Name, "check_"), res.Message)
+		if res.Fix != "" {
+			fmt.Fprintf(out, "       fix: %s\n", res.Fix)
+		}
+		if res.Status == web.CheckFail {
+			code = 1
+		}
+	}
+	return code
+}
+
+// localClient talks to the instance running on this computer.
+func localClient(cfg config.Config) *http.Client {
+	client := &http.Client{Timeout: 3 * time.Second}
+	if cfg.HTTPS {
+		// это наш же сервер на этом компьютере, а сертификат обычно самоподписанный
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return client
+}
+
+func runStatusCommand(cfg config.Config, stdout, stderr io.Writer) int {
+	resp, err := localClient(cfg).Get(config.LocalURL(cfg) + "/api/v1/status")
+	if err != nil {
+		fmt.Fprintf(stderr, "TrackGameName is not running on port %d: %v\n", cfg.WebPort, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	var status web.StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		fmt.Fprintf(stderr, "Unexpected answer from port %d: %v\n", cfg.WebPort, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "version:   %s\n", status.Version)
+	fmt.Fprintf(stdout, "retroarch: %s\n", map[bool]string{true: "running", false: "not running"}[status.RetroarchRunning])
+	fmt.Fprintf(stdout, "game:      %s\n", status.Game)
+	fmt.Fprintf(stdout, "system:    %s\n", status.Console)
+	return 0
+}
+
+// runStatsCommand exports the counters of the running instance, as served on
+// /metrics, to a file or to stdout.
+func runStatsCommand(cfg config.Config, args []string, stdout, stderr io.Writer) int {
+	const usage = "usage: stats export [-format prometheus|json] [FILE]"
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("stats export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "prometheus", "output format: prometheus (text exposition format) or json")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 || *format != "prometheus" && *format != "json" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	resp, err := localClient(cfg).Get(config.LocalURL(cfg) + "/metrics")
+	if err != nil {
+		fmt.Fprintf(stderr, "TrackGameName is not running on port %d: %v\n", cfg.WebPort, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status %s", resp.Status)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Unexpected answer from port %d: %v\n", cfg.WebPort, err)
+		return 1
+	}
+	if *format == "json" {
+		if data, err = metricsJSON(data); err != nil {
+			fmt.Fprintf(stderr, "Unexpected answer from port %d: %v\n", cfg.WebPort, err)
+			return 1
+		}
+	}
+	if fs.NArg() == 0 {
+		if _, err := stdout.Write(data); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if err := os.WriteFile(fs.Arg(0), data, 0644); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// metricsJSON turns the Prometheus text format into a JSON object of sample
+// name, labels included, to value.
+func metricsJSON(text []byte) ([]byte, error) {
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid metrics line %q", line)
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics line %q", line)
+		}
+		samples[line[:i]] = value
+	}
+	data, err := json.MarshalIndent(samples, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// runReplayCommand prints every change of the detected game in a recording,
+// noting where the recorded result differs from what detection decides now.
+func runReplayCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: replay FILE")
+		return 2
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSYSTEM\tGAME\tRECORDED")
+	var last tracker.State
+	first := true
+	err = detection.Replay(file, func(tick detection.Tick, state tracker.State) {
+		recorded := ""
+		if tick.Game != state.Game || tick.System != state.System {
+			recorded = tick.System + " / " + tick.Game
+		}
+		if !first && state.Game == last.Game && state.System == last.System && recorded == "" {
+			return
+		}
+		first, last = false, state
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", tick.Time.Format("2006-01-02 15:04:05.000"), state.System, state.Game, recorded)
+	})
+	if flushErr := tw.Flush(); flushErr != nil {
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func runTemplatesCommand(cfg config.Config, appDir string, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: templates list | templates add -process NAME [...] | templates remove ID|PROCESS | templates export FILE [ID...] | templates import [-conflict MODE] [-dry-run] FILE")
+		return 2
+	}
+	savePath := cfg.SavePath
+	if savePath == "" {
+		var err error
+		if savePath, err = filepath.Abs(appDir); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	t := tracker.New(cfg, savePath, fsutil.OS)
+	if err := t.LoadTemplates(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPROCESS\tWINDOW TITLE\tSYSTEM\tGAME\tPRIORITY")
+		for _, tmpl := range t.Templates() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", tmpl.ID, tmpl.ProcessName, tmpl.WindowTitle, tmpl.System, tmpl.Game, tmpl.Priority)
+		}
+		if err := tw.Flush(); err != nil {
+			return 1
+		}
+		return 0
+	case "add":
+		fs := flag.NewFlagSet("templates add", flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		var tmpl templates.Template
+		fs.StringVar(&tmpl.ProcessName, "process", "", "process name, e.g. Game.exe (required)")
+		fs.StringVar(&tmpl.WindowTitle, "title", "", "window title shown as the game name")
+		fs.StringVar(&tmpl.System, "system", "", "system name (default Windows)")
+		fs.StringVar(&tmpl.Game, "game", "", "game name (default: process name without .exe)")
+		fs.IntVar(&tmpl.Priority, "priority", 0, "priority when several games run at once")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		tmpl.ID = templates.NewID()
+		if fields := templates.Validate(&tmpl, t.Templates()); len(fields) > 0 {
+			for field, msg := range fields {
+				fmt.Fprintf(stderr, "%s: %s\n", field, msg)
+			}
+			return 1
+		}
+		err := t.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			return append(list, tmpl), nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, tmpl.ID)
+		return 0
+	case "remove":
+		if len(args) != 2 {
+			fmt.Fprintln(stderr, "usage: templates remove ID|PROCESS")
+			return 2
+		}
+		if args[1] == templates.RetroarchID {
+			fmt.Fprintln(stderr, "the built-in RetroArch template cannot be removed")
+			return 1
+		}
+		errNotFound := fmt.Errorf("template %q not found", args[1])
+		err := t.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			before := len(list)
+			if templates.Find(list, args[1]) >= 0 {
+				list = templates.Remove(list, args[1], "")
+			} else {
+				list = templates.Remove(list, "", args[1])
+			}
+			if len(list) == before {
+				return nil, errNotFound
+			}
+			return list, nil
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "export":
+		if len(args) < 2 {
+			fmt.Fprintln(stderr, "usage: templates export FILE [ID...]")
+			return 2
+		}
+		var buf bytes.Buffer
+		if err := web.ExportPack(&buf, t, args[2:]); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if err := os.WriteFile(args[1], buf.Bytes(), 0644); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "import":
+		fs := flag.NewFlagSet("templates import", flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		mode := fs.String("conflict", templates.ConflictSkip, "what to do with templates that already exist: skip, overwrite or rename")
+		dryRun := fs.Bool("dry-run", false, "only print what would be imported")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if fs.NArg() != 1 || !slices.Contains(templates.ConflictModes, *mode) {
+			fmt.Fprintln(stderr, "usage: templates import [-conflict skip|overwrite|rename] [-dry-run] FILE")
+			return 2
+		}
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		pack, err := web.ReadPack(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		results, err := web.ImportPack(t, pack, *mode, *dryRun)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		code := 0
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACTION\tPROCESS\tWINDOW TITLE\tNOTE")
+		for _, res := range results {
+			note := res.RenamedTo
+			if len(res.Errors) > 0 {
+				code = 1
+				var errs []string
+				for field, msg := range res.Errors {
+					errs = append(errs, field+": "+msg)
+				}
+				slices.Sort(errs)
+				note = strings.Join(errs, "; ")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Action, res.ProcessName, res.WindowTitle, note)
+		}
+		if err := tw.Flush(); err != nil {
+			return 1
+		}
+		if *dryRun {
+			fmt.Fprintln(stdout, "dry run, nothing was changed")
+		}
+		return code
+	default:
+		fmt.Fprintf(stderr, "unknown templates command %q\n", args[0])
+		return 2
+	}
+}
+
+// runConfigCommand reads or changes config.ini values. New values are checked
+// with the rules of the settings page before anything is written.
+func runConfigCommand(configPath, appDir string, args []string, stdout, stderr io.Writer) int {
+	if len(args) < 2 || args[0] == "get" && len(args) != 2 || args[0] == "set" && len(args)%2 != 1 {
+		fmt.Fprintln(stderr, "usage: config get KEY | config set KEY VALUE [KEY VALUE...]")
+		fmt.Fprintf(stderr, "keys: %s\n", strings.Join(config.Keys(), ", "))
+		return 2
+	}
+	values := make(map[string]string)
+	var keys []string
+	for i := 1; i < len(args); i += 2 {
+		key := args[i]
+		if !slices.Contains(config.Keys(), key) {
+			fmt.Fprintf(stderr, "unknown key %q\nkeys: %s\n", key, strings.Join(config.Keys(), ", "))
+			return 2
+		}
+		if i+1 < len(args) {
+			values[key] = args[i+1]
+		}
+		keys = append(keys, key)
+	}
+	file, err := ini.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading %s: %v\n", configPath, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "get":
+		fmt.Fprintln(stdout, file.Section("").Key(keys[0]).String())
+		return 0
+	case "set":
+		current, err := config.Read(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading %s: %v\n", configPath, err)
+			return 1
+		}
+		savePath := current.SavePath
+		if savePath == "" {
+			savePath = appDir
+		}
+		dirs := web.Dirs{Theme: config.ResourcePath(savePath, "Theme"), Lang: config.ResourcePath(appDir, "lang")}
+		next, fieldErrors, err := web.ApplySettings(dirs, current, values)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if len(fieldErrors) > 0 {
+			for _, key := range slices.Sorted(maps.Keys(fieldErrors)) {
+				fmt.Fprintf(stderr, "invalid value for %s: %s\n", key, fieldErrors[key])
+			}
+			return 1
+		}
+		// пишем только заданные ключи, остальной файл не трогаем
+		written := config.Values(next)
+		for _, key := range keys {
+			file.Section("").Key(key).SetValue(written[key])
+		}
+		if err := file.SaveTo(configPath); err != nil {
+			fmt.Fprintf(stderr, "Error saving %s: %v\n", configPath, err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown config command %q\n", args[0])
+		return 2
+	}
+}
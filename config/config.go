@@ -0,0 +1,358 @@
+// Package config reads, writes and migrates config.ini and finds where it
+// lives.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+type Config struct {
+	RetroarchPath           string            `ini:"retroarch_path"`
+	SavePath                string            `ini:"save_path"`
+	SaveToOneFile           bool              `ini:"save_to_one_file"`
+	Autorun                 bool              `ini:"autorun"`
+	OutputToFiles           bool              `ini:"output_to_files"`
+	ClearOutputOnExit       bool              `ini:"clear_output_on_exit"`
+	WebPort                 int               `ini:"web_port"`
+	BindAddress             string            `ini:"bind_address"`
+	AdminToken              string            `ini:"admin_token"`
+	HTTPS                   bool              `ini:"https"`
+	TLSCertFile             string            `ini:"tls_cert_file"`
+	TLSKeyFile              string            `ini:"tls_key_file"`
+	HTTPRedirectPort        int               `ini:"http_redirect_port"`
+	AgentURL                string            `ini:"agent_url"`
+	AgentToken              string            `ini:"agent_token"`
+	AgentCAFile             string            `ini:"agent_ca_file"`
+	AgentSlot               string            `ini:"agent_slot"`
+	SystemIcon              int               `ini:"system_icon"`
+	Theme                   string            `ini:"theme"`
+	Language                string            `ini:"language"`
+	ThumbnailsPath          string            `ini:"thumbnails_path"`
+	EnableThumbnails        bool              `ini:"enable_thumbnails"`
+	ThumbnailSize           string            `ini:"thumbnail_size"`
+	ThumbnailTypes          []string          `ini:"thumbnail_types" delim:","`
+	AlternateThumbnails     bool              `ini:"alternate_thumbnails"`
+	ThumbnailSwitchInterval int               `ini:"thumbnail_switch_interval"`
+	FadeDuration            float64           `ini:"fade_duration"`
+	FadeType                string            `ini:"fade_type"`
+	ConflictPolicy          string            `ini:"conflict_policy"`
+	ExcludedUsers           []string          `ini:"excluded_users" delim:","`
+	ExcludedProcesses       []string          `ini:"excluded_processes" delim:","`
+	ExcludedPaths           []string          `ini:"excluded_paths" delim:","`
+	ExcludeSystemDirs       bool              `ini:"exclude_system_dirs"`
+	LogLevel                string            `ini:"log_level"`
+	LogFormat               string            `ini:"log_format"`
+	LogMaxSizeMB            int               `ini:"log_max_size_mb"`
+	LogMaxAgeDays           int               `ini:"log_max_age_days"`
+	Systems                 map[string]string `ini:"systems"`
+}
+
+// Conflict policies decide which template wins when several are running at once.
+const (
+	PolicyForeground = "foreground" // focused window wins, otherwise keep the current game
+	PolicySticky     = "sticky"     // keep the current game until its process exits
+	PolicyRecent     = "recent"     // the most recently started process wins
+	PolicyPriority   = "priority"   // the highest template priority wins
+)
+
+var ConflictPolicies = []string{PolicyForeground, PolicySticky, PolicyRecent, PolicyPriority}
+
+func IsValidConflictPolicy(policy string) bool {
+	for _, p := range ConflictPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// DefaultBindAddress keeps the web server reachable from this computer only.
+const DefaultBindAddress = "127.0.0.1"
+
+// ListenAddr is the host:port the web server listens on.
+func ListenAddr(cfg Config) string {
+	return net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.WebPort))
+}
+
+// LocalURL is the address of the web server for a browser on this computer.
+func LocalURL(cfg Config) string {
+	host := cfg.BindAddress
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	scheme := "http"
+	if cfg.HTTPS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.WebPort))
+}
+
+// IsLocalOnly reports whether the bind address only accepts connections from
+// this computer.
+func IsLocalOnly(cfg Config) bool {
+	if cfg.BindAddress == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(cfg.BindAddress)
+	return ip != nil && ip.IsLoopback()
+}
+
+// FadeTypes are the CSS timing functions allowed for fade_type.
+var FadeTypes = []string{"ease", "ease-in", "ease-out", "ease-in-out", "linear"}
+
+// DefaultThumbnailTypes are the thumbnails shown when thumbnail_types is
+// empty: the title screen, then the box art.
+var DefaultThumbnailTypes = []string{"title", "boxart"}
+
+// Defaults used when config.ini has no exclusion keys yet.
+var DefaultExcludedUsers = []string{
+	"СИСТЕМА",
+	"SYSTEM",
+	"LOCAL SERVICE",
+	"NETWORK SERVICE",
+	"DWM-1",
+	"UMFD-1",
+	"UMFD-0",
+}
+
+var DefaultExcludedProcesses = []string{
+	"explorer.exe",
+	"TextInputHost.exe",
+	"ApplicationFrameHost.exe",
+	"SystemSettings.exe",
+	"TrackGameName.exe",
+}
+
+// ValidLogLevel reports whether value is one of debug, info, warn or error.
+func ValidLogLevel(value string) bool {
+	var level slog.Level
+	return level.UnmarshalText([]byte(value)) == nil
+}
+
+// Read maps a parsed config.ini onto Config and fills in defaults.
+func Read(cfg *ini.File) (Config, error) {
+	newConfig := Config{
+		Systems: make(map[string]string),
+	}
+	if err := cfg.MapTo(&newConfig); err != nil {
+		return Config{}, err
+	}
+
+	if !IsValidConflictPolicy(newConfig.ConflictPolicy) {
+		newConfig.ConflictPolicy = PolicyForeground
+	}
+	if !ValidLogLevel(newConfig.LogLevel) {
+		newConfig.LogLevel = "info"
+	}
+	if newConfig.LogFormat != LogFormatJSON {
+		newConfig.LogFormat = LogFormatText
+	}
+	newConfig.TLSCertFile = CleanPath(newConfig.TLSCertFile)
+	newConfig.TLSKeyFile = CleanPath(newConfig.TLSKeyFile)
+	newConfig.AgentCAFile = CleanPath(newConfig.AgentCAFile)
+	newConfig.AgentURL = strings.TrimRight(strings.TrimSpace(newConfig.AgentURL), "/")
+	newConfig.AgentSlot = strings.TrimSpace(newConfig.AgentSlot)
+	var types []string
+	for _, t := range newConfig.ThumbnailTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	if len(types) == 0 {
+		types = DefaultThumbnailTypes
+	}
+	newConfig.ThumbnailTypes = types
+	newConfig.BindAddress = strings.TrimSpace(newConfig.BindAddress)
+	if newConfig.BindAddress == "" {
+		newConfig.BindAddress = DefaultBindAddress
+	}
+
+	systemsSection := cfg.Section("systems")
+	for _, key := range systemsSection.Keys() {
+		newConfig.Systems[key.Name()] = key.String()
+	}
+	return newConfig, nil
+}
+
+// newDefault returns the config.ini written on the first start.
+func newDefault() *ini.File {
+	cfg := ini.Empty()
+	cfg.Section("").Key("retroarch_path").SetValue("C:\\RetroArch-Win64")
+	cfg.Section("").Key("save_path").SetValue("")
+	cfg.Section("").Key("save_to_one_file").SetValue("false")
+	cfg.Section("").Key("autorun").SetValue("false")
+	cfg.Section("").Key("output_to_files").SetValue("true")
+	cfg.Section("").Key("clear_output_on_exit").SetValue("false")
+	cfg.Section("").Key("web_port").SetValue("3489")
+	cfg.Section("").Key("bind_address").SetValue(DefaultBindAddress)
+	cfg.Section("").Key("admin_token").SetValue("")
+	cfg.Section("").Key("https").SetValue("false")
+	cfg.Section("").Key("tls_cert_file").SetValue("")
+	cfg.Section("").Key("tls_key_file").SetValue("")
+	cfg.Section("").Key("http_redirect_port").SetValue("0")
+	cfg.Section("").Key("agent_url").SetValue("")
+	cfg.Section("").Key("agent_token").SetValue("")
+	cfg.Section("").Key("agent_ca_file").SetValue("")
+	cfg.Section("").Key("agent_slot").SetValue("")
+	cfg.Section("").Key("system_icon").SetValue("0")
+	cfg.Section("").Key("theme").SetValue("default")
+	cfg.Section("").Key("language").SetValue("en")
+	cfg.Section("").Key("thumbnails_path").SetValue("")
+	cfg.Section("").Key("enable_thumbnails").SetValue("false")
+	cfg.Section("").Key("thumbnail_size").SetValue("0")
+	cfg.Section("").Key("thumbnail_types").SetValue(strings.Join(DefaultThumbnailTypes, ","))
+	cfg.Section("").Key("alternate_thumbnails").SetValue("false")
+	cfg.Section("").Key("thumbnail_switch_interval").SetValue("5")
+	cfg.Section("").Key("fade_duration").SetValue("0.5")
+	cfg.Section("").Key("fade_type").SetValue("ease-out")
+	cfg.Section("").Key("conflict_policy").SetValue(PolicyForeground)
+	cfg.Section("").Key("excluded_users").SetValue(strings.Join(DefaultExcludedUsers, ","))
+	cfg.Section("").Key("excluded_processes").SetValue(strings.Join(DefaultExcludedProcesses, ","))
+	cfg.Section("").Key("excluded_paths").SetValue("")
+	cfg.Section("").Key("exclude_system_dirs").SetValue("true")
+	cfg.Section("").Key("log_level").SetValue("info")
+	cfg.Section("").Key("log_format").SetValue(LogFormatText)
+	cfg.Section("").Key("log_max_size_mb").SetValue("5")
+	cfg.Section("").Key("log_max_age_days").SetValue("14")
+	cfg.Section("").Key("config_version").SetValue(strconv.Itoa(SchemaVersion))
+	cfg.Section("systems").Key("Nintendo - Nintendo Entertainment System").SetValue("nes.png")
+	return cfg
+}
+
+// Load reads path, creating it with defaults on the first start and migrating
+// files written by older versions. A failed migration is returned as
+// migrateErr; the file is then read as it is.
+func Load(path string) (cfg Config, migrateErr, err error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		slog.Warn("Error loading config", "path", path, "err", err)
+		file = newDefault()
+		if err := file.SaveTo(path); err != nil {
+			return Config{}, nil, fmt.Errorf("error creating %s: %v", path, err)
+		}
+		slog.Info("Config file created", "path", path)
+	}
+	migrateErr = Migrate(file, path)
+
+	cfg, err = Read(file)
+	if err != nil {
+		return Config{}, migrateErr, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return cfg, migrateErr, nil
+}
+
+// Save writes the settings of cfg to path, keeping comments and unknown keys.
+// Keys listed in keep are left as they are in the file.
+func Save(path string, cfg Config, keep ...string) error {
+	file, err := ini.Load(path)
+	if err != nil {
+		return err
+	}
+	values := Values(cfg)
+	for _, key := range keep {
+		delete(values, key)
+	}
+	for key, value := range values {
+		file.Section("").Key(key).SetValue(value)
+	}
+	return file.SaveTo(path)
+}
+
+// Keys lists the keys of the main config.ini section, taken from Config.
+func Keys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("ini"); key != "" && key != "systems" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Values returns every key of the main section as Save writes it for cfg.
+func Values(cfg Config) map[string]string {
+	return map[string]string{
+		"retroarch_path":            cfg.RetroarchPath,
+		"save_path":                 cfg.SavePath,
+		"save_to_one_file":          strconv.FormatBool(cfg.SaveToOneFile),
+		"autorun":                   strconv.FormatBool(cfg.Autorun),
+		"output_to_files":           strconv.FormatBool(cfg.OutputToFiles),
+		"clear_output_on_exit":      strconv.FormatBool(cfg.ClearOutputOnExit),
+		"web_port":                  strconv.Itoa(cfg.WebPort),
+		"bind_address":              cfg.BindAddress,
+		"admin_token":               cfg.AdminToken,
+		"https":                     strconv.FormatBool(cfg.HTTPS),
+		"tls_cert_file":             cfg.TLSCertFile,
+		"tls_key_file":              cfg.TLSKeyFile,
+		"http_redirect_port":        strconv.Itoa(cfg.HTTPRedirectPort),
+		"agent_url":                 cfg.AgentURL,
+		"agent_token":               cfg.AgentToken,
+		"agent_ca_file":             cfg.AgentCAFile,
+		"agent_slot":                cfg.AgentSlot,
+		"system_icon":               strconv.Itoa(cfg.SystemIcon),
+		"theme":                     cfg.Theme,
+		"language":                  cfg.Language,
+		"thumbnails_path":           cfg.ThumbnailsPath,
+		"enable_thumbnails":         strconv.FormatBool(cfg.EnableThumbnails),
+		"thumbnail_size":            cfg.ThumbnailSize,
+		"thumbnail_types":           strings.Join(cfg.ThumbnailTypes, ","),
+		"alternate_thumbnails":      strconv.FormatBool(cfg.AlternateThumbnails),
+		"thumbnail_switch_interval": strconv.Itoa(cfg.ThumbnailSwitchInterval),
+		"fade_duration":             strconv.FormatFloat(cfg.FadeDuration, 'f', 2, 64),
+		"fade_type":                 cfg.FadeType,
+		"conflict_policy":           cfg.ConflictPolicy,
+		"excluded_users":            strings.Join(cfg.ExcludedUsers, ","),
+		"excluded_processes":        strings.Join(cfg.ExcludedProcesses, ","),
+		"excluded_paths":            strings.Join(cfg.ExcludedPaths, ","),
+		"exclude_system_dirs":       strconv.FormatBool(cfg.ExcludeSystemDirs),
+		"log_level":                 cfg.LogLevel,
+		"log_format":                cfg.LogFormat,
+		"log_max_size_mb":           strconv.Itoa(cfg.LogMaxSizeMB),
+		"log_max_age_days":          strconv.Itoa(cfg.LogMaxAgeDays),
+	}
+}
+
+// IsBoolKey reports whether key of the main section holds true or false.
+func IsBoolKey(key string) bool {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("ini") == key {
+			return t.Field(i).Type.Kind() == reflect.Bool
+		}
+	}
+	return false
+}
+
+// SplitList parses a comma-separated settings field, dropping empty entries.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// CleanPath trims a folder setting and drops trailing slashes.
+func CleanPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+const (
+	ConfigEnvVar   = "TRACKGAMENAME_CONFIG"
+	ProfileEnvVar  = "TRACKGAMENAME_PROFILE"
+	DefaultProfile = "default"
+	portableMarker = "portable"
+)
+
+func ExecutableDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Dir(exe)
+}
+
+func isWritableDir(dir string) bool {
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	_ = f.Close()
+	_ = os.Remove(name)
+	return true
+}
+
+// ResolvePath picks config.ini in this order: the -config flag, the
+// TRACKGAMENAME_CONFIG variable, the program folder (always, if it contains a
+// "portable" file), the per-user config folder. When no config.ini exists yet
+// it is created next to the program if that folder is writable, otherwise in
+// the per-user folder.
+func ResolvePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(ConfigEnvVar); env != "" {
+		return env
+	}
+	exeConfig := filepath.Join(ExecutableDir(), "config.ini")
+	if fsutil.Exists(filepath.Join(ExecutableDir(), portableMarker)) || fsutil.Exists(exeConfig) {
+		return exeConfig
+	}
+	userConfig := ""
+	if dir, err := os.UserConfigDir(); err == nil {
+		userConfig = filepath.Join(dir, "TrackGameName", "config.ini")
+		if fsutil.Exists(userConfig) {
+			return userConfig
+		}
+	}
+	if userConfig == "" || isWritableDir(ExecutableDir()) {
+		return exeConfig
+	}
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0755); err != nil {
+		slog.Error("Error creating config folder", "path", filepath.Dir(userConfig), "err", err)
+		return exeConfig
+	}
+	return userConfig
+}
+
+// ResourcePath returns name inside the user's folder if it exists there and
+// falls back to the copy shipped next to the program.
+func ResourcePath(userDir, name string) string {
+	userPath := filepath.Join(userDir, name)
+	if fsutil.Exists(userPath) {
+		return userPath
+	}
+	if shipped := filepath.Join(ExecutableDir(), name); fsutil.Exists(shipped) {
+		return shipped
+	}
+	return userPath
+}
+
+// Profiles finds the config.ini of every profile. Dir holds the profiles
+// folder and the active_profile file; Base is the config.ini of the default
+// profile.
+type Profiles struct {
+	Dir  string
+	Base string
+}
+
+func (p Profiles) folder() string {
+	return filepath.Join(p.Dir, "profiles")
+}
+
+// Path returns the config.ini of profile name.
+func (p Profiles) Path(name string) string {
+	if name == DefaultProfile || name == "" {
+		return p.Base
+	}
+	return filepath.Join(p.folder(), name+".ini")
+}
+
+// List returns "default" followed by every profiles/*.ini file.
+func (p Profiles) List() []string {
+	profiles := []string{DefaultProfile}
+	entries, err := os.ReadDir(p.folder())
+	if err != nil {
+		return profiles
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".ini") {
+			names = append(names, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		}
+	}
+	sort.Strings(names)
+	return append(profiles, names...)
+}
+
+// Select decides which profile to start with: the -profile flag, the
+// TRACKGAMENAME_PROFILE variable or the profile chosen last time in the tray.
+func (p Profiles) Select(flagValue string) string {
+	name := flagValue
+	if name == "" {
+		name = os.Getenv(ProfileEnvVar)
+	}
+	if name == "" {
+		if data, err := os.ReadFile(filepath.Join(p.Dir, "active_profile")); err == nil {
+			name = strings.TrimSpace(string(data))
+		}
+	}
+	if name == "" {
+		return DefaultProfile
+	}
+	if !fsutil.Exists(p.Path(name)) {
+		slog.Warn("Profile not found, using default", "profile", name)
+		return DefaultProfile
+	}
+	return name
+}
+
+// SaveActive remembers name as the profile to start with next time.
+func (p Profiles) SaveActive(name string) error {
+	return os.WriteFile(filepath.Join(p.Dir, "active_profile"), []byte(name), 0644)
+}
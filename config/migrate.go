@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"WatchdogRetroArch/internal/fsutil"
+
+	"gopkg.in/ini.v1"
+)
+
+// SchemaVersion is the current config.ini format. Bump it together with a new
+// step in Migrate.
+const SchemaVersion = 8
+
+// Migrate upgrades config.ini in place. The previous file is kept as a
+// backup before anything is written.
+func Migrate(cfg *ini.File, path string) error {
+	section := cfg.Section("")
+	version := 0
+	if section.HasKey("config_version") {
+		v, err := strconv.Atoi(section.Key("config_version").String())
+		if err != nil {
+			return fmt.Errorf("invalid config_version %q", section.Key("config_version").String())
+		}
+		version = v
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("config.ini version %d is newer than supported version %d", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+
+	backup, err := fsutil.BackupFile(fsutil.OS, path, version)
+	if err != nil {
+		return fmt.Errorf("error backing up %s: %v", path, err)
+	}
+
+	if version < 1 {
+		// v0 -> v1: добавляем новые ключи со значениями по умолчанию и
+		// чистим пути от лишних пробелов и завершающих слэшей
+		defaults := map[string]string{
+			"conflict_policy":     PolicyForeground,
+			"excluded_users":      strings.Join(DefaultExcludedUsers, ","),
+			"excluded_processes":  strings.Join(DefaultExcludedProcesses, ","),
+			"excluded_paths":      "",
+			"exclude_system_dirs": "true",
+		}
+		for key, value := range defaults {
+			if !section.HasKey(key) {
+				section.Key(key).SetValue(value)
+			}
+		}
+		for _, key := range []string{"retroarch_path", "save_path", "thumbnails_path"} {
+			if section.HasKey(key) {
+				section.Key(key).SetValue(CleanPath(section.Key(key).String()))
+			}
+		}
+	}
+
+	if version < 2 {
+		// v1 -> v2: настройки журнала
+		defaults := map[string]string{
+			"log_level":        "info",
+			"log_format":       "text",
+			"log_max_size_mb":  "5",
+			"log_max_age_days": "14",
+		}
+		for key, value := range defaults {
+			if !section.HasKey(key) {
+				section.Key(key).SetValue(value)
+			}
+		}
+	}
+
+	if version < 3 {
+		// v2 -> v3: очистка выходных файлов при выходе
+		if !section.HasKey("clear_output_on_exit") {
+			section.Key("clear_output_on_exit").SetValue("false")
+		}
+	}
+
+	if version < 4 {
+		// v3 -> v4: веб-сервер по умолчанию слушает только localhost
+		if !section.HasKey("bind_address") {
+			section.Key("bind_address").SetValue(DefaultBindAddress)
+		}
+		if !section.HasKey("admin_token") {
+			section.Key("admin_token").SetValue("")
+		}
+	}
+
+	if version < 5 {
+		// v4 -> v5: HTTPS
+		defaults := map[string]string{
+			"https":              "false",
+			"tls_cert_file":      "",
+			"tls_key_file":       "",
+			"http_redirect_port": "0",
+		}
+		for key, value := range defaults {
+			if !section.HasKey(key) {
+				section.Key(key).SetValue(value)
+			}
+		}
+	}
+
+	if version < 6 {
+		// v5 -> v6: агент на игровом компьютере
+		for _, key := range []string{"agent_url", "agent_token", "agent_ca_file"} {
+			if !section.HasKey(key) {
+				section.Key(key).SetValue("")
+			}
+		}
+	}
+
+	if version < 7 {
+		// v6 -> v7: слот, в который агент отправляет игру
+		if !section.HasKey("agent_slot") {
+			section.Key("agent_slot").SetValue("")
+		}
+	}
+
+	if version < 8 {
+		// v7 -> v8: выбор и порядок типов миниатюр
+		if !section.HasKey("thumbnail_types") {
+			section.Key("thumbnail_types").SetValue(strings.Join(DefaultThumbnailTypes, ","))
+		}
+	}
+
+	section.Key("config_version").SetValue(strconv.Itoa(SchemaVersion))
+	if err := cfg.SaveTo(path); err != nil {
+		return fmt.Errorf("error saving migrated %s: %v", path, err)
+	}
+	slog.Info("Migrated config", "path", path, "from", version, "to", SchemaVersion, "backup", backup)
+	return nil
+}
@@ -0,0 +1,128 @@
+package detection
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+// Detector decides which template is active and tells the tracker what is
+// being played.
+type Detector struct {
+	tracker     *tracker.Tracker
+	source      Source
+	clock       Clock
+	metrics     *metrics.Metrics
+	started     map[string]processStart
+	activeKey   string
+	initialized bool
+}
+
+// NewDetector returns a detector that reports to t what it sees in src.
+func NewDetector(t *tracker.Tracker, src Source, clock Clock, m *metrics.Metrics) *Detector {
+	return &Detector{
+		tracker: t,
+		source:  src,
+		clock:   clock,
+		metrics: m,
+		started: make(map[string]processStart),
+	}
+}
+
+// Run checks for the active game after every process change, and at least
+// once a second, until ctx is done.
+func (d *Detector) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		loopStart := d.clock.Now()
+		d.tick()
+		if r, ok := d.source.(*Recorder); ok {
+			r.endTick(d.clock.Now(), d.tracker.Snapshot())
+		}
+		d.metrics.LoopDone(d.clock.Now().Sub(loopStart))
+		d.waitForProcessChange(ctx, 1*time.Second)
+	}
+}
+
+func (d *Detector) tick() {
+	running := d.source.Running()
+	_, retroarchRunning := running[strings.ToLower(retroarch.ProcessName)]
+	if !d.initialized || retroarchRunning != d.tracker.LocalState().RetroarchRunning {
+		d.tracker.SetRetroarchRunning(retroarchRunning)
+		if !retroarchRunning {
+			d.tracker.ClearGame()
+		}
+		d.initialized = true // инициализация завершена
+	}
+
+	cfg := d.tracker.Config()
+	candidates := markRunning(d.tracker.Templates(), running, d.started, d.clock.Now())
+
+	foregroundPID, err := d.source.ForegroundPID()
+	if err != nil {
+		slog.Error("Error getting foreground process", "err", err)
+		d.metrics.SetError(err)
+		return
+	}
+
+	active, ok := selectActive(candidates, cfg.ConflictPolicy, foregroundPID, d.activeKey)
+	if !ok {
+		d.activeKey = ""
+		return
+	}
+	if key := templates.Key(active.Template); d.activeKey != key {
+		slog.Info("Active template changed", "process", active.ProcessName, "policy", cfg.ConflictPolicy)
+		d.activeKey = key
+	}
+
+	if active.WindowTitle == retroarch.WindowTitle { // если игра RetroArch
+		game, system, err := d.source.History(cfg.RetroarchPath)
+		if err != nil {
+			slog.Warn("Error reading content_history.lpl", "err", err)
+			d.metrics.SetError(err)
+			return
+		}
+		if game != "" {
+			d.setGame(system, game)
+		}
+		return
+	}
+
+	windowTitle := active.WindowTitle
+	if windowTitle == "" {
+		windowTitle, err = d.source.WindowTitle(active.PID)
+		if err != nil || windowTitle == "" {
+			windowTitle = active.Game
+		}
+	}
+	d.setGame(active.System, windowTitle)
+}
+
+func (d *Detector) setGame(system, game string) {
+	if d.tracker.SetGame(system, game) {
+		d.metrics.GameChanged()
+	}
+}
+
+// waitForProcessChange blocks until a process starts or stops, ctx is done or
+// timeout passes; the timeout still matters because focus changes produce no event.
+func (d *Detector) waitForProcessChange(ctx context.Context, timeout time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-d.source.Changes():
+		// забираем остальные накопившиеся события, чтобы не крутиться вхолостую
+		for {
+			select {
+			case <-d.source.Changes():
+			default:
+				return
+			}
+		}
+	case <-d.clock.After(timeout):
+	}
+}
@@ -0,0 +1,80 @@
+package detection
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"WatchdogRetroArch/config"
+)
+
+// exclusionRules hides processes from the settings-games picker.
+type exclusionRules struct {
+	users     map[string]struct{}
+	processes map[string]struct{}
+	paths     []string
+}
+
+func newExclusionRules(cfg config.Config) exclusionRules {
+	rules := exclusionRules{
+		users:     make(map[string]struct{}),
+		processes: make(map[string]struct{}),
+	}
+	for _, u := range cfg.ExcludedUsers {
+		rules.users[strings.ToLower(u)] = struct{}{}
+	}
+	for _, p := range cfg.ExcludedProcesses {
+		rules.processes[strings.ToLower(p)] = struct{}{}
+	}
+	for _, p := range cfg.ExcludedPaths {
+		rules.paths = append(rules.paths, normalizeDir(p))
+	}
+	if cfg.ExcludeSystemDirs {
+		rules.paths = append(rules.paths, systemDirs()...)
+	}
+	return rules
+}
+
+func (r exclusionRules) excludes(username, name, exe string) bool {
+	// Username() возвращает "DOMAIN\user", в правилах обычно указано только имя
+	user := strings.ToLower(username)
+	if i := strings.LastIndex(user, `\`); i >= 0 {
+		user = user[i+1:]
+	}
+	if _, ok := r.users[user]; ok {
+		return true
+	}
+	if _, ok := r.users[strings.ToLower(username)]; ok {
+		return true
+	}
+	if _, ok := r.processes[strings.ToLower(name)]; ok {
+		return true
+	}
+	if exe != "" {
+		exe = strings.ToLower(filepath.Clean(exe))
+		for _, dir := range r.paths {
+			if strings.HasPrefix(exe, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func systemDirs() []string {
+	var dirs []string
+	for _, env := range []string{"SystemRoot", "windir"} {
+		if dir := os.Getenv(env); dir != "" {
+			dirs = append(dirs, normalizeDir(dir))
+		}
+	}
+	return dirs
+}
+
+func normalizeDir(dir string) string {
+	dir = strings.ToLower(filepath.Clean(strings.TrimSpace(dir)))
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return dir
+}
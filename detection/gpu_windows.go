@@ -0,0 +1,128 @@
+package detection
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modPdh = windows.NewLazySystemDLL("pdh.dll")
+
+	procPdhOpenQueryW                = modPdh.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounterW        = modPdh.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData          = modPdh.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterArrayW = modPdh.NewProc("PdhGetFormattedCounterArrayW")
+	procPdhCloseQuery                = modPdh.NewProc("PdhCloseQuery")
+)
+
+const (
+	pdhFmtDouble   = 0x00000200
+	pdhFmtNoCap100 = 0x00008000
+	pdhMoreData    = 0x800007D2
+)
+
+// gpuEngineCounter is the load of every GPU engine; instance names look like
+// "pid_1234_luid_0x00000000_0x0000D1B4_phys_0_eng_0_engtype_3D".
+const gpuEngineCounter = `\GPU Engine(*)\Utilization Percentage`
+
+// pdhCounterValueItem is PDH_FMT_COUNTERVALUE_ITEM_W. The value union holds
+// a double, so it starts at offset 8 and the item is 24 bytes on 32 and 64 bit.
+type pdhCounterValueItem struct {
+	Name   *uint16
+	_      [8 - unsafe.Sizeof(uintptr(0))]byte
+	Status uint32
+	_      uint32
+	Value  float64
+}
+
+// gpuSampler measures GPU load per process between start and usage.
+type gpuSampler struct {
+	query   uintptr
+	counter uintptr
+}
+
+// startGPUSample takes the first sample. It fails on systems without GPU
+// performance counters (before Windows 10 1709 or without a WDDM 2 driver).
+func startGPUSample() (*gpuSampler, error) {
+	var s gpuSampler
+	if r, _, _ := procPdhOpenQueryW.Call(0, 0, uintptr(unsafe.Pointer(&s.query))); r != 0 {
+		return nil, fmt.Errorf("PdhOpenQuery failed: 0x%x", r)
+	}
+	path, err := windows.UTF16PtrFromString(gpuEngineCounter)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	if r, _, _ := procPdhAddEnglishCounterW.Call(s.query, uintptr(unsafe.Pointer(path)), 0, uintptr(unsafe.Pointer(&s.counter))); r != 0 {
+		s.close()
+		return nil, fmt.Errorf("PdhAddEnglishCounter failed: 0x%x", r)
+	}
+	if r, _, _ := procPdhCollectQueryData.Call(s.query); r != 0 {
+		s.close()
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", r)
+	}
+	return &s, nil
+}
+
+// usage takes the second sample and returns the load of every process since
+// the first one, summed over its engines: 1 is one engine fully busy.
+func (s *gpuSampler) usage() (map[int32]float64, error) {
+	defer s.close()
+	if r, _, _ := procPdhCollectQueryData.Call(s.query); r != 0 {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", r)
+	}
+	var size, count uint32
+	r, _, _ := procPdhGetFormattedCounterArrayW.Call(s.counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), 0)
+	if r != pdhMoreData {
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: 0x%x", r)
+	}
+	if size == 0 || count == 0 {
+		return map[int32]float64{}, nil
+	}
+	// Буфер выравниваем по 8 байт: в нём лежат double
+	buf := make([]uint64, (size+7)/8)
+	r, _, _ = procPdhGetFormattedCounterArrayW.Call(s.counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&buf[0])))
+	if r != 0 {
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: 0x%x", r)
+	}
+
+	items := unsafe.Slice((*pdhCounterValueItem)(unsafe.Pointer(&buf[0])), count)
+	usage := make(map[int32]float64)
+	for _, item := range items {
+		if item.Status > 1 { // PDH_CSTATUS_VALID_DATA или PDH_CSTATUS_NEW_DATA
+			continue
+		}
+		pid, ok := gpuInstancePID(windows.UTF16PtrToString(item.Name))
+		if ok && item.Value > 0 {
+			usage[pid] += item.Value / 100
+		}
+	}
+	return usage, nil
+}
+
+func (s *gpuSampler) close() {
+	if s.query != 0 {
+		procPdhCloseQuery.Call(s.query)
+		s.query = 0
+	}
+}
+
+// gpuInstancePID reads the PID out of a GPU Engine instance name.
+func gpuInstancePID(instance string) (int32, bool) {
+	rest, ok := strings.CutPrefix(instance, "pid_")
+	if !ok {
+		return 0, false
+	}
+	digits, _, _ := strings.Cut(rest, "_")
+	pid, err := strconv.ParseInt(digits, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(pid), true
+}
@@ -0,0 +1,127 @@
+package detection
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/templates"
+)
+
+// Candidate is a template together with the state of its process.
+type Candidate struct {
+	templates.Template
+	PID       int32
+	Running   bool
+	StartedAt time.Time
+}
+
+// processStart is when a template's process was first seen and its PID then.
+type processStart struct {
+	pid int32
+	at  time.Time
+}
+
+// markRunning pairs every template with its process. started remembers when
+// each template was first seen running, so that the "recent" policy has a
+// start time; entries of templates that stopped are removed, and a new PID
+// counts as a new start, because the game was restarted between two ticks.
+// running maps lower-cased process names to their PID.
+func markRunning(tmpls []templates.Template, running map[string]int32, started map[string]processStart, now time.Time) []Candidate {
+	candidates := make([]Candidate, len(tmpls))
+	for i, tmpl := range tmpls {
+		key := templates.Key(tmpl)
+		pid, ok := running[strings.ToLower(tmpl.ProcessName)]
+		if !ok {
+			delete(started, key)
+		} else if s, seen := started[key]; !seen || s.pid != pid {
+			started[key] = processStart{pid: pid, at: now}
+		}
+		candidates[i] = Candidate{Template: tmpl, PID: pid, Running: ok, StartedAt: started[key].at}
+	}
+	return candidates
+}
+
+// selectActive picks one template out of the running ones according to
+// policy. currentKey is the templates.Key of the game shown right now (may be empty).
+// Ties are always broken by priority, then start time, then process name, so the
+// result does not depend on the order of templates in games.json.
+func selectActive(candidates []Candidate, policy string, foregroundPID int32, currentKey string) (Candidate, bool) {
+	var running []Candidate
+	for _, tmpl := range candidates {
+		if tmpl.Running {
+			running = append(running, tmpl)
+		}
+	}
+	if len(running) == 0 {
+		return Candidate{}, false
+	}
+
+	byPriority := func(a, b Candidate) bool {
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.After(b.StartedAt)
+		}
+		return a.ProcessName < b.ProcessName
+	}
+	byRecent := func(a, b Candidate) bool {
+		if !a.StartedAt.Equal(b.StartedAt) {
+			return a.StartedAt.After(b.StartedAt)
+		}
+		return byPriority(a, b)
+	}
+
+	find := func(match func(Candidate) bool) (Candidate, bool) {
+		for _, tmpl := range running {
+			if match(tmpl) {
+				return tmpl, true
+			}
+		}
+		return Candidate{}, false
+	}
+	current := func() (Candidate, bool) {
+		if currentKey == "" {
+			return Candidate{}, false
+		}
+		return find(func(t Candidate) bool { return templates.Key(t.Template) == currentKey })
+	}
+	foreground := func() (Candidate, bool) {
+		if foregroundPID == 0 {
+			return Candidate{}, false
+		}
+		return find(func(t Candidate) bool { return t.PID == foregroundPID })
+	}
+
+	switch policy {
+	case config.PolicySticky:
+		if tmpl, ok := current(); ok {
+			return tmpl, true
+		}
+		sort.SliceStable(running, func(i, j int) bool { return byPriority(running[i], running[j]) })
+	case config.PolicyRecent:
+		sort.SliceStable(running, func(i, j int) bool { return byRecent(running[i], running[j]) })
+	case config.PolicyPriority:
+		sort.SliceStable(running, func(i, j int) bool {
+			if running[i].Priority == running[j].Priority {
+				iFg := foregroundPID != 0 && running[i].PID == foregroundPID
+				jFg := foregroundPID != 0 && running[j].PID == foregroundPID
+				if iFg != jFg {
+					return iFg
+				}
+			}
+			return byPriority(running[i], running[j])
+		})
+	default: // config.PolicyForeground
+		if tmpl, ok := foreground(); ok {
+			return tmpl, true
+		}
+		if tmpl, ok := current(); ok {
+			return tmpl, true
+		}
+		sort.SliceStable(running, func(i, j int) bool { return byPriority(running[i], running[j]) })
+	}
+	return running[0], true
+}
@@ -0,0 +1,273 @@
+package detection
+
+import (
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/templates"
+)
+
+var t0 = time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+
+func candidate(process string, pid int32, priority int, startedAt time.Time) Candidate {
+	return Candidate{
+		Template:  templates.Template{ProcessName: process, Priority: priority},
+		PID:       pid,
+		Running:   pid != 0,
+		StartedAt: startedAt,
+	}
+}
+
+func currentKeyOf(process string) string {
+	return templates.Key(templates.Template{ProcessName: process})
+}
+
+func TestSelectActive(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		candidates []Candidate
+		foreground int32
+		current    string
+		want       string // "" means nothing is running
+	}{
+		{
+			name:   "nothing running",
+			policy: config.PolicyForeground,
+			candidates: []Candidate{
+				candidate("a.exe", 0, 5, time.Time{}),
+			},
+			want: "",
+		},
+
+		// foreground
+		{
+			name:   "foreground: focused window wins over priority",
+			policy: config.PolicyForeground,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 9, t0),
+				candidate("b.exe", 20, 0, t0),
+			},
+			foreground: 20,
+			want:       "b.exe",
+		},
+		{
+			name:   "foreground: keeps current game when focus is elsewhere",
+			policy: config.PolicyForeground,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 9, t0),
+				candidate("b.exe", 20, 0, t0),
+			},
+			foreground: 99,
+			current:    currentKeyOf("b.exe"),
+			want:       "b.exe",
+		},
+		{
+			name:   "foreground: falls back to priority",
+			policy: config.PolicyForeground,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 1, t0),
+				candidate("b.exe", 20, 2, t0),
+			},
+			want: "b.exe",
+		},
+		{
+			name:   "foreground: current game that stopped is ignored",
+			policy: config.PolicyForeground,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 1, t0),
+				candidate("b.exe", 0, 2, time.Time{}),
+			},
+			current: currentKeyOf("b.exe"),
+			want:    "a.exe",
+		},
+		{
+			name:   "unknown policy behaves like foreground",
+			policy: "bogus",
+			candidates: []Candidate{
+				candidate("a.exe", 10, 9, t0),
+				candidate("b.exe", 20, 0, t0),
+			},
+			foreground: 20,
+			want:       "b.exe",
+		},
+
+		// sticky
+		{
+			name:   "sticky: keeps current game even without focus",
+			policy: config.PolicySticky,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 9, t0.Add(time.Minute)),
+				candidate("b.exe", 20, 0, t0),
+			},
+			foreground: 10,
+			current:    currentKeyOf("b.exe"),
+			want:       "b.exe",
+		},
+		{
+			name:   "sticky: without current game highest priority wins",
+			policy: config.PolicySticky,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 1, t0),
+				candidate("b.exe", 20, 3, t0),
+			},
+			foreground: 10,
+			want:       "b.exe",
+		},
+
+		// recent
+		{
+			name:   "recent: newest start wins over priority",
+			policy: config.PolicyRecent,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 9, t0),
+				candidate("b.exe", 20, 0, t0.Add(time.Second)),
+			},
+			want: "b.exe",
+		},
+		{
+			name:   "recent: equal start time goes to priority",
+			policy: config.PolicyRecent,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 0, t0),
+				candidate("b.exe", 20, 4, t0),
+			},
+			want: "b.exe",
+		},
+		{
+			name:   "recent: equal start time and priority goes to process name",
+			policy: config.PolicyRecent,
+			candidates: []Candidate{
+				candidate("b.exe", 20, 1, t0),
+				candidate("a.exe", 10, 1, t0),
+			},
+			want: "a.exe",
+		},
+
+		// priority
+		{
+			name:   "priority: highest priority wins over focus",
+			policy: config.PolicyPriority,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 0, t0),
+				candidate("b.exe", 20, 5, t0),
+			},
+			foreground: 10,
+			want:       "b.exe",
+		},
+		{
+			name:   "priority: focus breaks a priority tie",
+			policy: config.PolicyPriority,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 5, t0.Add(time.Minute)),
+				candidate("b.exe", 20, 5, t0),
+			},
+			foreground: 20,
+			want:       "b.exe",
+		},
+		{
+			name:   "priority: newer start breaks a priority tie without focus",
+			policy: config.PolicyPriority,
+			candidates: []Candidate{
+				candidate("a.exe", 10, 5, t0),
+				candidate("b.exe", 20, 5, t0.Add(time.Minute)),
+			},
+			want: "b.exe",
+		},
+		{
+			name:   "priority: equal start time goes to process name",
+			policy: config.PolicyPriority,
+			candidates: []Candidate{
+				candidate("c.exe", 30, 5, t0),
+				candidate("b.exe", 20, 5, t0),
+				candidate("a.exe", 10, 1, t0),
+			},
+			want: "b.exe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := selectActive(tt.candidates, tt.policy, tt.foreground, tt.current)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("selectActive() = %s, want nothing", got.ProcessName)
+				}
+				return
+			}
+			if !ok || got.ProcessName != tt.want {
+				t.Fatalf("selectActive() = %q, %v, want %q", got.ProcessName, ok, tt.want)
+			}
+		})
+	}
+}
+
+// TestSelectActiveOrder checks that the order of templates in games.json does
+// not change the result.
+func TestSelectActiveOrder(t *testing.T) {
+	candidates := []Candidate{
+		candidate("a.exe", 10, 2, t0),
+		candidate("b.exe", 20, 2, t0),
+		candidate("c.exe", 30, 2, t0),
+	}
+	for _, policy := range config.ConflictPolicies {
+		var first string
+		for i := range candidates {
+			rotated := append(append([]Candidate{}, candidates[i:]...), candidates[:i]...)
+			got, _ := selectActive(rotated, policy, 0, "")
+			if i == 0 {
+				first = got.ProcessName
+			} else if got.ProcessName != first {
+				t.Errorf("%s: got %s for rotation %d, %s for rotation 0", policy, got.ProcessName, i, first)
+			}
+		}
+	}
+}
+
+func TestMarkRunning(t *testing.T) {
+	tmpls := []templates.Template{
+		{ProcessName: "Game.exe"},
+		{ProcessName: "other.exe"},
+	}
+	started := make(map[string]processStart)
+	step := func(running map[string]int32, now time.Time) []Candidate {
+		t.Helper()
+		return markRunning(tmpls, running, started, now)
+	}
+
+	got := step(map[string]int32{"game.exe": 100}, t0)
+	if !got[0].Running || got[0].PID != 100 || !got[0].StartedAt.Equal(t0) {
+		t.Fatalf("first tick: %+v", got[0])
+	}
+	if got[1].Running || !got[1].StartedAt.IsZero() {
+		t.Fatalf("other.exe is not running: %+v", got[1])
+	}
+
+	// тот же процесс: время запуска не меняется
+	got = step(map[string]int32{"game.exe": 100}, t0.Add(time.Second))
+	if !got[0].StartedAt.Equal(t0) {
+		t.Errorf("same PID: StartedAt = %v, want %v", got[0].StartedAt, t0)
+	}
+
+	// игру перезапустили между тиками: новый PID считается новым запуском
+	got = step(map[string]int32{"game.exe": 200}, t0.Add(2*time.Second))
+	if got[0].PID != 200 || !got[0].StartedAt.Equal(t0.Add(2*time.Second)) {
+		t.Errorf("restart: %+v", got[0])
+	}
+
+	// игра закрылась, её PID достался другому процессу
+	got = step(map[string]int32{"other.exe": 200}, t0.Add(3*time.Second))
+	if got[0].Running {
+		t.Errorf("Game.exe still running after exit: %+v", got[0])
+	}
+	if _, ok := started[templates.Key(tmpls[0])]; ok {
+		t.Error("start time of the stopped game is kept")
+	}
+	if !got[1].Running || !got[1].StartedAt.Equal(t0.Add(3*time.Second)) {
+		t.Errorf("other.exe with reused PID: %+v", got[1])
+	}
+	active, ok := selectActive(got, config.PolicyForeground, 200, templates.Key(tmpls[0]))
+	if !ok || active.ProcessName != "other.exe" {
+		t.Errorf("reused PID selected %q, want other.exe", active.ProcessName)
+	}
+}
@@ -0,0 +1,145 @@
+package detection
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"WatchdogRetroArch/config"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+type ProcessInfo struct {
+	Name  string `json:"name"`
+	Pid   int32  `json:"pid"`
+	Title string `json:"title"`
+	Icon  string `json:"icon"`
+	load  float64
+}
+
+// loadSampleTime is how long ListProcesses measures CPU and GPU load.
+const loadSampleTime = 200 * time.Millisecond
+
+// ListProcesses returns candidates for the settings-games picker: processes of
+// the current user that own a visible window, minus the exclusions in cfg,
+// busiest first. A process is as busy as its CPU and GPU load added up, so a
+// game that mostly renders ranks above a tool that mostly computes.
+func ListProcesses(cfg config.Config) ([]ProcessInfo, error) {
+	rules := newExclusionRules(cfg)
+
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	windowTitles, err := visibleWindows()
+	if err != nil {
+		slog.Error("Error listing windows, showing all processes", "err", err)
+	}
+
+	type candidate struct {
+		proc  *process.Process
+		info  ProcessInfo
+		start float64
+	}
+	var candidates []candidate
+	for _, p := range processes {
+		title, hasWindow := windowTitles[p.Pid]
+		if windowTitles != nil && !hasWindow {
+			continue
+		}
+		username, err := p.Username()
+		if err != nil {
+			continue
+		}
+		name, err := p.Name()
+		if err != nil {
+			continue
+		}
+		exe, _ := p.Exe()
+		if rules.excludes(username, name, exe) {
+			continue
+		}
+		var cpuTotal float64
+		if times, err := p.Times(); err == nil {
+			cpuTotal = times.User + times.System
+		}
+		info := ProcessInfo{Name: name, Pid: p.Pid, Title: title}
+		if exe != "" {
+			info.Icon = exeIconDataURL(exe)
+		}
+		candidates = append(candidates, candidate{proc: p, info: info, start: cpuTotal})
+	}
+
+	// Замеряем нагрузку за короткий интервал, чтобы наверху оказались активные игры,
+	// а не процессы с большим накопленным временем CPU.
+	gpu, err := startGPUSample()
+	if err != nil {
+		slog.Debug("GPU load is not available, sorting processes by CPU only", "err", err)
+	}
+	time.Sleep(loadSampleTime)
+	var gpuUsage map[int32]float64
+	if gpu != nil {
+		if gpuUsage, err = gpu.usage(); err != nil {
+			slog.Debug("GPU load is not available, sorting processes by CPU only", "err", err)
+		}
+	}
+	byName := make(map[string]ProcessInfo)
+	for _, c := range candidates {
+		if times, err := c.proc.Times(); err == nil {
+			c.info.load = (times.User + times.System - c.start) / loadSampleTime.Seconds()
+		}
+		c.info.load += gpuUsage[c.info.Pid]
+		key := strings.ToLower(c.info.Name)
+		if existing, ok := byName[key]; !ok || c.info.load > existing.load {
+			byName[key] = c.info
+		}
+	}
+
+	userProcesses := make([]ProcessInfo, 0, len(byName))
+	for _, info := range byName {
+		userProcesses = append(userProcesses, info)
+	}
+	sort.Slice(userProcesses, func(i, j int) bool {
+		if userProcesses[i].load != userProcesses[j].load {
+			return userProcesses[i].load > userProcesses[j].load
+		}
+		return strings.ToLower(userProcesses[i].Name) < strings.ToLower(userProcesses[j].Name)
+	})
+	return userProcesses, nil
+}
+
+// ProcessDetails returns the name and window title of pid, given as a number
+// or a string from a WebSocket message.
+func ProcessDetails(pid interface{}) (interface{}, error) {
+	var pPid int32
+	switch p := pid.(type) {
+	case int32:
+		pPid = p
+	case string:
+		pidInt, _ := strconv.Atoi(p)
+		pPid = int32(pidInt)
+	default:
+		return nil, fmt.Errorf("unsupported type: %T", pid)
+	}
+	p, _ := process.NewProcess(pPid)
+	name, err := p.Name()
+	if err != nil {
+		name = ""
+		slog.Warn("Failed to get process name", "pid", pPid, "err", err)
+	}
+
+	title, _ := WindowTitle(pPid)
+	if err != nil {
+		slog.Warn("Failed to get window title", "pid", pPid, "err", err)
+		title = ""
+	}
+	data := struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	}{Name: name, Title: title}
+	return data, nil
+}
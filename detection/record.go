@@ -0,0 +1,153 @@
+package detection
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+// Tick is what the detector saw and decided on one pass. A recording is a
+// file with one Tick per line.
+type Tick struct {
+	Time   time.Time `json:"time"`
+	Policy string    `json:"policy"`
+	// Templates is only set when they changed since the previous tick.
+	Templates []templates.Template `json:"templates,omitempty"`
+	// Processes only lists processes that some template matches.
+	Processes     map[string]int32 `json:"processes"`
+	ForegroundPID int32            `json:"foreground_pid"`
+	ForegroundErr string           `json:"foreground_error,omitempty"`
+	WindowTitles  map[int32]string `json:"window_titles,omitempty"`
+	History       *HistoryHead     `json:"history,omitempty"`
+	// Game and System are what the tracker showed after the tick.
+	Game   string `json:"game"`
+	System string `json:"system"`
+}
+
+// HistoryHead is the newest entry of content_history.lpl as read on a tick.
+type HistoryHead struct {
+	Game   string `json:"game"`
+	System string `json:"system"`
+	Err    string `json:"error,omitempty"`
+}
+
+// Recorder is a Source that passes everything through and writes what the
+// detector asked for to a recording.
+type Recorder struct {
+	Source
+
+	mu        sync.Mutex
+	file      *os.File
+	out       *bufio.Writer
+	tick      Tick
+	templates []templates.Template
+}
+
+// NewRecorder records the ticks of src to path, replacing an older recording.
+func NewRecorder(src Source, path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Source: src, file: file, out: bufio.NewWriter(file)}, nil
+}
+
+func (r *Recorder) Running() map[string]int32 {
+	running := r.Source.Running()
+	r.mu.Lock()
+	r.tick.Processes = running
+	r.mu.Unlock()
+	return running
+}
+
+func (r *Recorder) ForegroundPID() (int32, error) {
+	pid, err := r.Source.ForegroundPID()
+	r.mu.Lock()
+	r.tick.ForegroundPID = pid
+	if err != nil {
+		r.tick.ForegroundErr = err.Error()
+	}
+	r.mu.Unlock()
+	return pid, err
+}
+
+func (r *Recorder) WindowTitle(pid int32) (string, error) {
+	title, err := r.Source.WindowTitle(pid)
+	if err == nil {
+		r.mu.Lock()
+		if r.tick.WindowTitles == nil {
+			r.tick.WindowTitles = make(map[int32]string)
+		}
+		r.tick.WindowTitles[pid] = title
+		r.mu.Unlock()
+	}
+	return title, err
+}
+
+func (r *Recorder) History(retroarchPath string) (string, string, error) {
+	game, system, err := r.Source.History(retroarchPath)
+	head := &HistoryHead{Game: game, System: system}
+	if err != nil {
+		head.Err = err.Error()
+	}
+	r.mu.Lock()
+	r.tick.History = head
+	r.mu.Unlock()
+	return game, system, err
+}
+
+// endTick writes the tick that just finished.
+func (r *Recorder) endTick(now time.Time, snap *tracker.Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tick := r.tick
+	r.tick = Tick{}
+
+	tick.Time = now
+	tick.Policy = snap.Config.ConflictPolicy
+	tick.Game, tick.System = snap.State.Game, snap.State.System
+	if !reflect.DeepEqual(snap.Templates, r.templates) {
+		tick.Templates = snap.Templates
+		r.templates = snap.Templates
+	}
+	// остальные процессы в запись не попадают: они не влияют на выбор и
+	// могут рассказать о пользователе лишнее
+	matched := make(map[string]int32)
+	for _, tmpl := range snap.Templates {
+		name := strings.ToLower(tmpl.ProcessName)
+		if pid, ok := tick.Processes[name]; ok {
+			matched[name] = pid
+		}
+	}
+	tick.Processes = matched
+
+	data, err := json.Marshal(tick)
+	if err == nil {
+		_, err = r.out.Write(append(data, '\n'))
+	}
+	if err == nil {
+		err = r.out.Flush()
+	}
+	if err != nil {
+		slog.Warn("Error writing detection recording", "err", err)
+	}
+}
+
+// Close finishes the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.out.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,97 @@
+package detection
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+// replaySource answers with what was recorded on the current tick.
+type replaySource struct {
+	tick Tick
+}
+
+func (s *replaySource) Running() map[string]int32    { return s.tick.Processes }
+func (s *replaySource) Changes() <-chan ProcessEvent { return nil }
+
+func (s *replaySource) ForegroundPID() (int32, error) {
+	if s.tick.ForegroundErr != "" {
+		return 0, fmt.Errorf("%s", s.tick.ForegroundErr)
+	}
+	return s.tick.ForegroundPID, nil
+}
+
+func (s *replaySource) WindowTitle(pid int32) (string, error) {
+	title, ok := s.tick.WindowTitles[pid]
+	if !ok {
+		return "", fmt.Errorf("no window title recorded for pid %d", pid)
+	}
+	return title, nil
+}
+
+func (s *replaySource) History(string) (string, string, error) {
+	head := s.tick.History
+	if head == nil {
+		return "", "", fmt.Errorf("content history was not read on this tick")
+	}
+	if head.Err != "" {
+		return "", "", fmt.Errorf("%s", head.Err)
+	}
+	return head.Game, head.System, nil
+}
+
+// replayClock stops at the time of the current tick.
+type replayClock struct {
+	src *replaySource
+}
+
+func (c replayClock) Now() time.Time { return c.src.tick.Time }
+
+func (c replayClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.src.tick.Time
+	return ch
+}
+
+// Replay feeds a recording made by a Recorder through a fresh Detector and
+// calls fn after every tick with the recorded tick and the state the detector
+// arrives at now. Nothing is read from or written to the disk.
+func Replay(in io.Reader, fn func(tick Tick, state tracker.State)) error {
+	src := &replaySource{}
+	t := tracker.New(config.Config{}, "replay", fsutil.NewMemFS())
+	d := NewDetector(t, src, replayClock{src: src}, metrics.New())
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var tick Tick
+		if err := json.Unmarshal(scanner.Bytes(), &tick); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if tick.Templates != nil {
+			recorded := tick.Templates
+			err := t.UpdateTemplates(func([]templates.Template) ([]templates.Template, error) {
+				return recorded, nil
+			})
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if cfg := t.Config(); cfg.ConflictPolicy != tick.Policy {
+			cfg.ConflictPolicy = tick.Policy
+			t.SetConfig(cfg)
+		}
+		src.tick = tick
+		d.tick()
+		fn(tick, t.State())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,228 @@
+package detection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+const snes = "Nintendo - Super Nintendo Entertainment System"
+
+// scenarioTemplates are the templates every scenario starts with.
+var scenarioTemplates = []templates.Template{
+	templates.NewRetroarch(),
+	{ID: "doom", ProcessName: "Doom.exe", System: "Windows", Game: "Doom"},
+	{ID: "quake", ProcessName: "Quake.exe", WindowTitle: "Quake", System: "Windows", Game: "Quake", Priority: 5},
+}
+
+// recording turns ticks into a recording as a Recorder writes it. The first
+// tick carries the templates.
+func recording(t *testing.T, ticks []Tick) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, tick := range ticks {
+		tick.Time = start.Add(time.Duration(i) * time.Second)
+		if tick.Policy == "" {
+			tick.Policy = config.PolicyForeground
+		}
+		if i == 0 {
+			tick.Templates = scenarioTemplates
+		}
+		if err := enc.Encode(tick); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func TestReplayScenarios(t *testing.T) {
+	retroarch := map[string]int32{"retroarch.exe": 10}
+	tests := []struct {
+		name  string
+		ticks []Tick
+	}{
+		{
+			name: "RetroArch game from the content history, then RetroArch closed",
+			ticks: []Tick{
+				{Processes: retroarch, ForegroundPID: 10, History: &HistoryHead{Game: "Super Mario World", System: snes}, Game: "Super Mario World", System: snes},
+				{Processes: retroarch, ForegroundPID: 10, History: &HistoryHead{Game: "Chrono Trigger", System: snes}, Game: "Chrono Trigger", System: snes},
+				{Processes: map[string]int32{}},
+			},
+		},
+		{
+			name: "content history that cannot be read keeps the game",
+			ticks: []Tick{
+				{Processes: retroarch, ForegroundPID: 10, History: &HistoryHead{Game: "Super Mario World", System: snes}, Game: "Super Mario World", System: snes},
+				{Processes: retroarch, ForegroundPID: 10, History: &HistoryHead{Err: "file is locked"}, Game: "Super Mario World", System: snes},
+			},
+		},
+		{
+			name: "window title names a Windows game, the game name stands in without one",
+			ticks: []Tick{
+				{Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom II: Hell on Earth"}, Game: "Doom II: Hell on Earth", System: "Windows"},
+				{Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, Game: "Doom", System: "Windows"},
+			},
+		},
+		{
+			name: "foreground policy follows the focus and keeps the game when nothing is focused",
+			ticks: []Tick{
+				{Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}, Game: "Doom", System: "Windows"},
+				{Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundPID: 30, Game: "Quake", System: "Windows"},
+				{Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundPID: 99, Game: "Quake", System: "Windows"},
+			},
+		},
+		{
+			name: "priority policy ignores the focus",
+			ticks: []Tick{
+				{Policy: config.PolicyPriority, Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundPID: 20, Game: "Quake", System: "Windows"},
+				{Policy: config.PolicyPriority, Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}, Game: "Doom", System: "Windows"},
+			},
+		},
+		{
+			name: "failed foreground lookup changes nothing",
+			ticks: []Tick{
+				{Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}, Game: "Doom", System: "Windows"},
+				{Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundErr: "access denied", Game: "Doom", System: "Windows"},
+			},
+		},
+		{
+			name: "game that exited stays until another one is detected",
+			ticks: []Tick{
+				{Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}, Game: "Doom", System: "Windows"},
+				{Processes: map[string]int32{}, Game: "Doom", System: "Windows"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := 0
+			err := Replay(recording(t, tt.ticks), func(tick Tick, state tracker.State) {
+				if state.Game != tick.Game || state.System != tick.System {
+					t.Errorf("tick %d: got %q on %q, want %q on %q", i, state.Game, state.System, tick.Game, tick.System)
+				}
+				i++
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i != len(tt.ticks) {
+				t.Errorf("replayed %d ticks, want %d", i, len(tt.ticks))
+			}
+		})
+	}
+}
+
+// scriptedSource plays one step per detection pass and cancels the run after
+// the last one.
+type scriptedSource struct {
+	replaySource
+	steps   []Tick
+	next    int
+	changes chan ProcessEvent
+	cancel  context.CancelFunc
+}
+
+func (s *scriptedSource) Running() map[string]int32 {
+	if s.next == len(s.steps) {
+		s.cancel()
+		return s.tick.Processes
+	}
+	s.tick = s.steps[s.next]
+	s.next++
+	// процесс сменился: детектор не должен ждать таймаута
+	select {
+	case s.changes <- ProcessEvent{}:
+	default:
+	}
+	return s.tick.Processes
+}
+
+func (s *scriptedSource) Changes() <-chan ProcessEvent { return s.changes }
+
+// fakeClock moves one second forward on every call to Now and never makes
+// the detector wait.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func (c *fakeClock) After(time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func TestDetectorRun(t *testing.T) {
+	tr := tracker.New(config.Config{ConflictPolicy: config.PolicyForeground}, "save", fsutil.NewMemFS())
+	err := tr.UpdateTemplates(func([]templates.Template) ([]templates.Template, error) {
+		return scenarioTemplates, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var events []string
+	tr.Subscribe("test", func(ev tracker.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Kind != tracker.TemplatesChanged {
+			events = append(events, fmt.Sprintf("%s %s", ev.Kind, ev.State.Game))
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &scriptedSource{changes: make(chan ProcessEvent, 1), cancel: cancel, steps: []Tick{
+		{Processes: map[string]int32{}},
+		{Processes: map[string]int32{"retroarch.exe": 10}, ForegroundPID: 10, History: &HistoryHead{Game: "Super Mario World", System: snes}},
+		{Processes: map[string]int32{"retroarch.exe": 10, "doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}},
+		{Processes: map[string]int32{"doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}},
+	}}
+	m := metrics.New()
+	done := make(chan struct{})
+	go func() {
+		NewDetector(tr, src, &fakeClock{}, m).Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("detector did not stop after the last step")
+	}
+	tr.Close()
+
+	want := []string{
+		"game_stopped ",
+		"retroarch_changed ",
+		"game_started Super Mario World",
+		"game_changed Doom",
+		"retroarch_changed Doom",
+		// RetroArch закрыт: игра сбрасывается и тут же находится снова
+		"game_stopped ",
+		"game_started Doom",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %q\nwant     %q", events, want)
+	}
+}
@@ -0,0 +1,50 @@
+package detection
+
+import (
+	"time"
+
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/retroarch"
+)
+
+// Source is everything the Detector looks at on a tick. The live source asks
+// Windows; a scripted one can replay game starts, focus changes and RetroArch
+// closing on any OS.
+type Source interface {
+	// Running maps the lower-case name of every running process to a PID.
+	Running() map[string]int32
+	// Changes wakes the detector when a process starts or stops.
+	Changes() <-chan ProcessEvent
+	ForegroundPID() (int32, error)
+	WindowTitle(pid int32) (string, error)
+	// History returns the newest entry of RetroArch's content history.
+	History(retroarchPath string) (game, system string, err error)
+}
+
+// Clock is the time the detector runs on.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// LiveSource reads the running processes from a Watcher and the rest from
+// Windows and the disk.
+type LiveSource struct {
+	Watcher *Watcher
+	FS      fsutil.FS
+}
+
+func (s LiveSource) Running() map[string]int32             { return s.Watcher.Running() }
+func (s LiveSource) Changes() <-chan ProcessEvent          { return s.Watcher.Events() }
+func (s LiveSource) ForegroundPID() (int32, error)         { return ForegroundPID() }
+func (s LiveSource) WindowTitle(pid int32) (string, error) { return WindowTitle(pid) }
+
+func (s LiveSource) History(retroarchPath string) (string, string, error) {
+	return retroarch.ReadHistory(s.FS, retroarchPath)
+}
@@ -0,0 +1,176 @@
+// Package detection finds which game template is running and reports it to
+// the tracker.
+package detection
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/metrics"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessEvent is emitted by Watcher when a process appears or disappears.
+type ProcessEvent struct {
+	Started bool
+	Pid     int32
+	Name    string
+}
+
+// Watcher keeps a live PID -> name table by diffing the PID list.
+// Listing PIDs is a single cheap system call, and process names are only
+// resolved for PIDs that were not seen on the previous scan, so the detection
+// loop no longer has to call Name() for every process on every tick.
+//
+// The list is still polled. The OS event sources need rights the program
+// does not have: the ETW kernel process provider and WMI's
+// Win32_ProcessStartTrace require an administrator, and the netlink proc
+// connector on Linux requires CAP_NET_ADMIN, while __InstanceCreationEvent
+// polls inside WMI at a coarser interval than ours. A Source built on one of
+// them can replace this watcher without changes to the Detector.
+type Watcher struct {
+	mu       sync.RWMutex
+	names    map[int32]string
+	unnamed  map[int32]struct{} // PIDs whose Name() failed, not asked again
+	interval time.Duration
+	events   chan ProcessEvent
+	metrics  *metrics.Metrics
+
+	pids func() ([]int32, error)
+	name func(pid int32) (string, error)
+}
+
+func NewWatcher(interval time.Duration, m *metrics.Metrics) *Watcher {
+	return newWatcher(interval, m, process.Pids, func(pid int32) (string, error) {
+		return (&process.Process{Pid: pid}).Name()
+	})
+}
+
+func newWatcher(interval time.Duration, m *metrics.Metrics, pids func() ([]int32, error), name func(int32) (string, error)) *Watcher {
+	w := &Watcher{
+		names:    make(map[int32]string),
+		unnamed:  make(map[int32]struct{}),
+		interval: interval,
+		events:   make(chan ProcessEvent, 256),
+		metrics:  m,
+		pids:     pids,
+		name:     name,
+	}
+	if err := w.scan(); err != nil {
+		slog.Error("Error scanning processes", "err", err)
+	}
+	return w
+}
+
+// Run scans the process list every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.scan(); err != nil {
+				slog.Error("Error scanning processes", "err", err)
+			}
+		}
+	}
+}
+
+// Events delivers start/stop notifications. Events are dropped when nobody
+// reads them in time; consumers should treat them as a wake-up signal and read
+// the current state through Running.
+func (w *Watcher) Events() <-chan ProcessEvent {
+	return w.events
+}
+
+func (w *Watcher) scan() error {
+	pids, err := w.pids()
+	if err != nil {
+		return err
+	}
+	w.metrics.ProcessesScanned(len(pids))
+	seen := make(map[int32]struct{}, len(pids))
+	var started []ProcessEvent
+	w.mu.RLock()
+	for _, pid := range pids {
+		seen[pid] = struct{}{}
+		_, known := w.names[pid]
+		_, unnamed := w.unnamed[pid]
+		if !known && !unnamed {
+			started = append(started, ProcessEvent{Started: true, Pid: pid})
+		}
+	}
+	var stopped []ProcessEvent
+	for pid, name := range w.names {
+		if _, ok := seen[pid]; !ok {
+			stopped = append(stopped, ProcessEvent{Started: false, Pid: pid, Name: name})
+		}
+	}
+	w.mu.RUnlock()
+
+	for i := range started {
+		name, err := w.name(started[i].Pid)
+		if err != nil {
+			continue // процесс уже завершился или недоступен
+		}
+		started[i].Name = name
+	}
+
+	w.mu.Lock()
+	for _, ev := range stopped {
+		delete(w.names, ev.Pid)
+	}
+	// PID без имени спрашиваем снова только после того, как он пропадёт из
+	// списка: тогда его может получить новый процесс
+	for pid := range w.unnamed {
+		if _, ok := seen[pid]; !ok {
+			delete(w.unnamed, pid)
+		}
+	}
+	for _, ev := range started {
+		if ev.Name != "" {
+			w.names[ev.Pid] = ev.Name
+		} else {
+			w.unnamed[ev.Pid] = struct{}{}
+		}
+	}
+	w.mu.Unlock()
+
+	for _, ev := range stopped {
+		w.emit(ev)
+	}
+	for _, ev := range started {
+		if ev.Name != "" {
+			w.emit(ev)
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) emit(ev ProcessEvent) {
+	select {
+	case w.events <- ev:
+	default:
+	}
+}
+
+// Running returns lower-cased process names mapped to the lowest PID running
+// under that name.
+func (w *Watcher) Running() map[string]int32 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	running := make(map[string]int32, len(w.names))
+	for pid, name := range w.names {
+		name = strings.ToLower(name)
+		if existing, ok := running[name]; !ok || pid < existing {
+			running[name] = pid
+		}
+	}
+	return running
+}
@@ -0,0 +1,121 @@
+package detection
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/metrics"
+)
+
+// fakeProcesses is a process list a test changes between scans.
+type fakeProcesses struct {
+	names   map[int32]string // "" means Name() fails
+	lookups map[int32]int
+}
+
+func (f *fakeProcesses) pids() ([]int32, error) {
+	pids := make([]int32, 0, len(f.names))
+	for pid := range f.names {
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func (f *fakeProcesses) name(pid int32) (string, error) {
+	f.lookups[pid]++
+	if f.names[pid] == "" {
+		return "", errors.New("access denied")
+	}
+	return f.names[pid], nil
+}
+
+func drain(w *Watcher) []ProcessEvent {
+	var events []ProcessEvent
+	for {
+		select {
+		case ev := <-w.Events():
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestWatcherScan(t *testing.T) {
+	procs := &fakeProcesses{
+		names:   map[int32]string{4: "", 100: "RetroArch.exe", 200: "game.exe", 300: "game.exe"},
+		lookups: make(map[int32]int),
+	}
+	w := newWatcher(time.Second, metrics.New(), procs.pids, procs.name)
+	if got := len(drain(w)); got != 3 {
+		t.Fatalf("first scan: %d events, want 3", got)
+	}
+	running := w.Running()
+	if running["retroarch.exe"] != 100 || running["game.exe"] != 200 {
+		t.Fatalf("Running() = %v", running)
+	}
+
+	tests := []struct {
+		name    string
+		change  func()
+		events  []ProcessEvent
+		lookups map[int32]int
+	}{
+		{
+			name:    "nothing changed, nothing looked up",
+			change:  func() {},
+			lookups: map[int32]int{4: 1, 100: 1, 200: 1, 300: 1},
+		},
+		{
+			name:    "new process",
+			change:  func() { procs.names[500] = "obs64.exe" },
+			events:  []ProcessEvent{{Started: true, Pid: 500, Name: "obs64.exe"}},
+			lookups: map[int32]int{4: 1, 500: 1},
+		},
+		{
+			name:    "stopped process",
+			change:  func() { delete(procs.names, 200) },
+			events:  []ProcessEvent{{Started: false, Pid: 200, Name: "game.exe"}},
+			lookups: map[int32]int{4: 1, 200: 1},
+		},
+		{
+			name: "reused PID without a name is asked again",
+			change: func() {
+				delete(procs.names, 4)
+			},
+			lookups: map[int32]int{4: 1},
+		},
+		{
+			name:    "reused PID",
+			change:  func() { procs.names[4] = "game.exe" },
+			events:  []ProcessEvent{{Started: true, Pid: 4, Name: "game.exe"}},
+			lookups: map[int32]int{4: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			if err := w.scan(); err != nil {
+				t.Fatal(err)
+			}
+			events := drain(w)
+			if len(events) != len(tt.events) {
+				t.Fatalf("events = %+v, want %+v", events, tt.events)
+			}
+			for i := range events {
+				if events[i] != tt.events[i] {
+					t.Errorf("event %d = %+v, want %+v", i, events[i], tt.events[i])
+				}
+			}
+			for pid, n := range tt.lookups {
+				if procs.lookups[pid] != n {
+					t.Errorf("Name(%d) called %d times, want %d", pid, procs.lookups[pid], n)
+				}
+			}
+		})
+	}
+	if got := w.Running()["game.exe"]; got != 4 {
+		t.Errorf("game.exe runs as %d, want the lowest PID 4", got)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package detection
+
+import "errors"
+
+// Windows, icons and GPU counters only exist on Windows. These stubs let the rest of the
+// package build elsewhere, where detection runs on a scripted Source.
+
+var errNotWindows = errors.New("window information is only available on Windows")
+
+func visibleWindows() (map[int32]string, error) {
+	return nil, errNotWindows
+}
+
+func exeIconDataURL(exePath string) string {
+	return ""
+}
+
+// ForegroundPID returns the process that owns the focused window.
+func ForegroundPID() (int32, error) {
+	return 0, errNotWindows
+}
+
+// WindowTitle returns the main window title of pid.
+func WindowTitle(pid int32) (string, error) {
+	return "", errNotWindows
+}
+
+type gpuSampler struct{}
+
+func startGPUSample() (*gpuSampler, error) {
+	return nil, errNotWindows
+}
+
+func (s *gpuSampler) usage() (map[int32]float64, error) {
+	return nil, errNotWindows
+}
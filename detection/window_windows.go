@@ -0,0 +1,233 @@
+package detection
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os/exec"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/go-vgo/robotgo"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modUser32  = windows.NewLazySystemDLL("user32.dll")
+	modShell32 = windows.NewLazySystemDLL("shell32.dll")
+	modGdi32   = windows.NewLazySystemDLL("gdi32.dll")
+
+	procGetWindowTextW       = modUser32.NewProc("GetWindowTextW")
+	procGetWindowTextLengthW = modUser32.NewProc("GetWindowTextLengthW")
+	procGetIconInfo          = modUser32.NewProc("GetIconInfo")
+	procDestroyIcon          = modUser32.NewProc("DestroyIcon")
+	procGetDC                = modUser32.NewProc("GetDC")
+	procReleaseDC            = modUser32.NewProc("ReleaseDC")
+	procExtractIconExW       = modShell32.NewProc("ExtractIconExW")
+	procGetObjectW           = modGdi32.NewProc("GetObjectW")
+	procGetDIBits            = modGdi32.NewProc("GetDIBits")
+	procDeleteObject         = modGdi32.NewProc("DeleteObject")
+)
+
+// visibleWindows returns the title of the first visible, titled top-level
+// window of every process that has one.
+func visibleWindows() (map[int32]string, error) {
+	windowsByPid := make(map[int32]string)
+	cb := windows.NewCallback(func(hwnd windows.HWND, _ uintptr) uintptr {
+		if !windows.IsWindowVisible(hwnd) {
+			return 1
+		}
+		title := windowText(hwnd)
+		if title == "" {
+			return 1
+		}
+		var pid uint32
+		if _, err := windows.GetWindowThreadProcessId(hwnd, &pid); err != nil {
+			return 1
+		}
+		if _, exists := windowsByPid[int32(pid)]; !exists {
+			windowsByPid[int32(pid)] = title
+		}
+		return 1
+	})
+	if err := windows.EnumWindows(cb, nil); err != nil {
+		return nil, fmt.Errorf("EnumWindows failed: %v", err)
+	}
+	return windowsByPid, nil
+}
+
+func windowText(hwnd windows.HWND) string {
+	length, _, _ := procGetWindowTextLengthW.Call(uintptr(hwnd))
+	if length == 0 {
+		return ""
+	}
+	buf := make([]uint16, length+1)
+	procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return windows.UTF16ToString(buf)
+}
+
+type iconInfo struct {
+	FIcon    int32
+	XHotspot uint32
+	YHotspot uint32
+	HbmMask  windows.Handle
+	HbmColor windows.Handle
+}
+
+type bitmap struct {
+	Type       int32
+	Width      int32
+	Height     int32
+	WidthBytes int32
+	Planes     uint16
+	BitsPixel  uint16
+	Bits       uintptr
+}
+
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+var (
+	iconCache      = make(map[string]string)
+	iconCacheMutex sync.Mutex
+)
+
+// exeIconDataURL extracts the first icon of an executable and returns it as a
+// PNG data URL. Results (including failures) are cached per path.
+func exeIconDataURL(exePath string) string {
+	iconCacheMutex.Lock()
+	defer iconCacheMutex.Unlock()
+	if icon, ok := iconCache[exePath]; ok {
+		return icon
+	}
+	icon, err := extractIcon(exePath)
+	if err != nil {
+		icon = ""
+	}
+	iconCache[exePath] = icon
+	return icon
+}
+
+func extractIcon(exePath string) (string, error) {
+	path, err := windows.UTF16PtrFromString(exePath)
+	if err != nil {
+		return "", err
+	}
+	var hIcon windows.Handle
+	n, _, _ := procExtractIconExW.Call(uintptr(unsafe.Pointer(path)), 0, 0, uintptr(unsafe.Pointer(&hIcon)), 1)
+	if n == 0 || hIcon == 0 {
+		return "", fmt.Errorf("no icon in %s", exePath)
+	}
+	defer procDestroyIcon.Call(uintptr(hIcon))
+
+	var info iconInfo
+	if ok, _, err := procGetIconInfo.Call(uintptr(hIcon), uintptr(unsafe.Pointer(&info))); ok == 0 {
+		return "", fmt.Errorf("GetIconInfo failed: %v", err)
+	}
+	defer procDeleteObject.Call(uintptr(info.HbmMask))
+	defer procDeleteObject.Call(uintptr(info.HbmColor))
+	if info.HbmColor == 0 {
+		return "", fmt.Errorf("monochrome icon in %s", exePath)
+	}
+
+	var bm bitmap
+	if n, _, _ := procGetObjectW.Call(uintptr(info.HbmColor), unsafe.Sizeof(bm), uintptr(unsafe.Pointer(&bm))); n == 0 {
+		return "", fmt.Errorf("GetObject failed for %s", exePath)
+	}
+	width, height := int(bm.Width), int(bm.Height)
+	if width <= 0 || height <= 0 {
+		return "", fmt.Errorf("empty icon in %s", exePath)
+	}
+
+	hdc, _, _ := procGetDC.Call(0)
+	defer procReleaseDC.Call(0, hdc)
+	header := bitmapInfoHeader{
+		Width:    int32(width),
+		Height:   -int32(height), // отрицательная высота — строки сверху вниз
+		Planes:   1,
+		BitCount: 32,
+	}
+	header.Size = uint32(unsafe.Sizeof(header))
+	pixels := make([]byte, width*height*4)
+	if n, _, _ := procGetDIBits.Call(hdc, uintptr(info.HbmColor), 0, uintptr(height),
+		uintptr(unsafe.Pointer(&pixels[0])), uintptr(unsafe.Pointer(&header)), 0); n == 0 {
+		return "", fmt.Errorf("GetDIBits failed for %s", exePath)
+	}
+
+	hasAlpha := false
+	for i := 3; i < len(pixels); i += 4 {
+		if pixels[i] != 0 {
+			hasAlpha = true
+			break
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y*width + x) * 4
+			a := pixels[i+3]
+			if !hasAlpha {
+				a = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: pixels[i+2], G: pixels[i+1], B: pixels[i], A: a})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// ForegroundPID returns the process that owns the focused window.
+func ForegroundPID() (int32, error) {
+	pid := robotgo.GetPid()
+	if pid == -1 {
+		return 0, fmt.Errorf("could not get foreground process PID")
+	}
+	return int32(pid), nil
+}
+
+// WindowTitle returns the main window title of pid as tasklist reports it.
+func WindowTitle(pid int32) (string, error) {
+	cmd := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/V")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("tasklist failed: %v", err)
+	}
+
+	output := out.String()
+	if strings.Contains(output, "No tasks are running") {
+		return "", nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return "", fmt.Errorf("unexpected tasklist output")
+	}
+
+	fields := strings.Split(lines[1], ",")
+	if len(fields) < 9 {
+		return "", fmt.Errorf("invalid tasklist output format")
+	}
+
+	title := strings.Trim(fields[8], `"`)
+	return title, nil
+}
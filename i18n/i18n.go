@@ -0,0 +1,76 @@
+// Package i18n loads the translations in the lang folder.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Language struct {
+	Code string
+	Name string
+}
+type Translations map[string]string
+
+// Load reads <dir>/<language>.json and returns its strings and the name of
+// the language.
+func Load(dir, language string) (Translations, string, error) {
+	langFile := filepath.Join(dir, language+".json")
+	data, err := os.ReadFile(langFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading translation %s: %v", langFile, err)
+	}
+
+	var rawData map[string]interface{}
+	err = json.Unmarshal(data, &rawData)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing translation %s: %v", langFile, err)
+	}
+
+	langName, ok := rawData["language_name"].(string)
+	if !ok {
+		langName = language
+	}
+
+	translations := make(Translations)
+	for key, value := range rawData {
+		if key != "language_name" {
+			if strValue, ok := value.(string); ok {
+				translations[key] = strValue
+			}
+		}
+	}
+
+	return translations, langName, nil
+}
+
+// Available lists the languages in dir, falling back to English.
+func Available(dir string) []Language {
+	var languages []Language
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error("Error reading lang folder", "err", err)
+		return []Language{{Code: "en", Name: "English"}}
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			code := strings.TrimSuffix(f.Name(), ".json")
+			_, langName, err := Load(dir, code)
+			if err != nil {
+				slog.Error("Error loading language", "lang", code, "err", err)
+				langName = code
+			}
+			languages = append(languages, Language{Code: code, Name: langName})
+		}
+	}
+
+	if len(languages) == 0 {
+		return []Language{{Code: "en", Name: "English"}}
+	}
+	return languages
+}
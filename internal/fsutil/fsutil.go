@@ -0,0 +1,52 @@
+// Package fsutil holds small file helpers shared by the config and templates
+// packages.
+package fsutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// FS is the filesystem that game templates, content history and thumbnails
+// are read from. OS is the real disk; a fake can stand in for it so those
+// code paths run without a RetroArch install.
+type FS interface {
+	Open(name string) (io.ReadCloser, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	ReadDir(name string) ([]os.DirEntry, error)
+}
+
+// OS is the FS backed by the os package.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)   { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)    { return os.ReadFile(name) }
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// BackupFile copies path next to itself with the old version in the name and
+// returns the backup location.
+func BackupFile(fsys FS, path string, version int) (string, error) {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := fsys.WriteFile(backup, data, 0644); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"WatchdogRetroArch/detection"
+	"WatchdogRetroArch/outputs"
+	"WatchdogRetroArch/tracker"
+	"WatchdogRetroArch/tray"
+	"WatchdogRetroArch/web"
+)
+
+// shutdownTimeout bounds how long shutdown waits for background goroutines
+// and open HTTP requests.
+const shutdownTimeout = 5 * time.Second
+
+// lifecycle owns the background goroutines and the web server of a running
+// tracker and stops them in order when the program exits.
+type lifecycle struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	tracker  *tracker.Tracker
+	recorder *detection.Recorder
+	server   *web.Server
+	outputs  *outputs.Writer
+	once     sync.Once
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine that shutdown waits for. fn must return once ctx is done.
+func (l *lifecycle) Go(fn func(ctx context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		fn(l.ctx)
+	}()
+}
+
+// quitOnSignal closes the tray, and with it the program, on Ctrl+C or when
+// Windows asks the process to stop.
+func (l *lifecycle) quitOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case sig := <-signals:
+		slog.Info("Received signal, shutting down", "signal", sig.String())
+		tray.Quit()
+	case <-l.ctx.Done():
+	}
+}
+
+// shutdown stops detection and file watching, lets event subscribers finish,
+// flushes the output files, closes WebSocket clients with a close frame and
+// stops the web server. It is safe to call more than once.
+func (l *lifecycle) shutdown() {
+	l.once.Do(func() {
+		slog.Info("Shutting down")
+		l.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			l.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			slog.Warn("Background tasks did not stop in time")
+		}
+
+		if l.recorder != nil {
+			if err := l.recorder.Close(); err != nil {
+				slog.Error("Error closing detection recording", "err", err)
+			}
+		}
+		// дожидаемся подписчиков, чтобы поздняя запись не затёрла Flush
+		if l.tracker != nil {
+			l.tracker.Close()
+		}
+		if l.outputs != nil {
+			l.outputs.Flush()
+		}
+
+		if l.server != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := l.server.Shutdown(ctx); err != nil {
+				slog.Error("Error stopping web server", "err", err)
+			}
+		}
+		slog.Info("TrackGameName exited")
+	})
+}
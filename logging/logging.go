@@ -0,0 +1,280 @@
+// Package logging sets up slog with a rotating log file and keeps the most
+// recent entries in memory for the /logs page.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/config"
+)
+
+const (
+	recentLogSize   = 500
+	logFileTimeName = "20060102-150405"
+)
+
+var (
+	// logLevel is shared by all handlers so the level can change without
+	// reopening the log.
+	logLevel   = new(slog.LevelVar)
+	logOutput  *rotatingFile
+	recentLogs = newLogBuffer(recentLogSize)
+)
+
+// rotatingFile is an append-only log file that is renamed to
+// <name>-<time>.log once it grows past maxSize. Rotated files older than
+// maxAge are deleted.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+	maxAge  time.Duration
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	r := &rotatingFile{path: path}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// setLimits changes the rotation limits; zero disables the limit.
+func (r *rotatingFile) setLimits(maxSize int64, maxAge time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxSize, r.maxAge = maxSize, maxAge
+	r.removeOld()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.path)
+	rotated := strings.TrimSuffix(r.path, ext) + "-" + time.Now().Format(logFileTimeName) + ext
+	renameErr := os.Rename(r.path, rotated)
+	// файл нужно открыть заново даже если переименовать не вышло
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.removeOld()
+	return renameErr
+}
+
+// removeOld deletes rotated files older than maxAge.
+func (r *rotatingFile) removeOld() {
+	if r.maxAge <= 0 {
+		return
+	}
+	ext := filepath.Ext(r.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && time.Since(info.ModTime()) > r.maxAge {
+			_ = os.Remove(match)
+		}
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Entry is one record kept in memory for the /logs page.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Attrs   string    `json:"attrs,omitempty"`
+}
+
+func (e Entry) String() string {
+	line := fmt.Sprintf("%s %-5s %s", e.Time.Format("2006-01-02 15:04:05"), e.Level, e.Message)
+	if e.Attrs != "" {
+		line += " " + e.Attrs
+	}
+	return line
+}
+
+// logBuffer is a fixed-size ring of the most recent log entries.
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{entries: make([]Entry, size)}
+}
+
+func (b *logBuffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// recent returns up to limit entries at or above minLevel, oldest first.
+func (b *logBuffer) recent(minLevel slog.Level, limit int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ordered := b.entries[:b.next]
+	if b.full {
+		ordered = append(append([]Entry(nil), b.entries[b.next:]...), b.entries[:b.next]...)
+	}
+	var result []Entry
+	for _, e := range ordered {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(e.Level)); err == nil && level >= minLevel {
+			result = append(result, e)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// recentHandler copies every record it handles into a logBuffer.
+type recentHandler struct {
+	slog.Handler
+	buf   *logBuffer
+	attrs []slog.Attr
+}
+
+func (h recentHandler) Handle(ctx context.Context, r slog.Record) error {
+	var attrs []string
+	for _, a := range h.attrs {
+		attrs = append(attrs, a.String())
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a.String())
+		return true
+	})
+	h.buf.add(Entry{Time: r.Time, Level: r.Level.String(), Message: r.Message, Attrs: strings.Join(attrs, " ")})
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h recentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return recentHandler{Handler: h.Handler.WithAttrs(attrs), buf: h.buf, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h recentHandler) WithGroup(name string) slog.Handler {
+	return recentHandler{Handler: h.Handler.WithGroup(name), buf: h.buf, attrs: h.attrs}
+}
+
+// newLogHandler builds the handler for the given format writing to out.
+func newLogHandler(out io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewTextHandler(out, opts)
+	if format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+	return recentHandler{Handler: handler, buf: recentLogs}
+}
+
+// Setup opens the log file and makes slog (and the standard log
+// package) write to it.
+func Setup(path string, level slog.Level) error {
+	file, err := openRotatingFile(path)
+	if err != nil {
+		return err
+	}
+	logOutput = file
+	logLevel.Set(level)
+	slog.SetDefault(slog.New(newLogHandler(logOutput, config.LogFormatText)))
+	return nil
+}
+
+// Apply applies the log_* settings. keepLevel leaves the level alone, for a
+// -log-level flag that wins over log_level.
+func Apply(cfg config.Config, keepLevel bool) {
+	if !keepLevel {
+		if level, err := ParseLevel(cfg.LogLevel); err == nil {
+			logLevel.Set(level)
+		}
+	}
+	if logOutput == nil {
+		return
+	}
+	logOutput.setLimits(int64(cfg.LogMaxSizeMB)<<20, time.Duration(cfg.LogMaxAgeDays)*24*time.Hour)
+	slog.SetDefault(slog.New(newLogHandler(logOutput, cfg.LogFormat)))
+}
+
+func Close() {
+	if logOutput == nil {
+		return
+	}
+	if err := logOutput.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to close log file: %v\n", err)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return level, fmt.Errorf("invalid log level %q: use debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// Recent returns up to limit of the latest entries at or above minLevel,
+// oldest first.
+func Recent(minLevel slog.Level, limit int) []Entry {
+	return recentLogs.recent(minLevel, limit)
+}
+
+// FilePath returns the path of the open log file, or "" before Setup.
+func FilePath() string {
+	if logOutput == nil {
+		return ""
+	}
+	return logOutput.path
+}
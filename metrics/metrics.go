@@ -0,0 +1,196 @@
+// Package metrics collects the counters behind /metrics and /healthz.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// heartbeatTimeout is how old the detection loop heartbeat may get before
+// /healthz reports the tracker as stalled. The loop normally ticks every second.
+const heartbeatTimeout = 10 * time.Second
+
+// loopDurationBuckets are the upper bounds, in seconds, of the detection loop
+// duration histogram.
+var loopDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Metrics collects the counters exported on /metrics. Prometheus is not
+// a dependency; the text format is simple enough to write by hand.
+type Metrics struct {
+	mu sync.Mutex
+
+	loopBuckets  []uint64
+	loopCount    uint64
+	loopSum      float64
+	lastLoop     time.Time
+	processes    int
+	scans        uint64
+	gameChanges  uint64
+	outputErrors uint64
+	thumbHits    uint64
+	thumbMisses  uint64
+
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func New() *Metrics {
+	return &Metrics{loopBuckets: make([]uint64, len(loopDurationBuckets))}
+}
+
+// LoopDone records one pass of the detection loop and refreshes the heartbeat.
+func (m *Metrics) LoopDone(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seconds := d.Seconds()
+	for i, bound := range loopDurationBuckets {
+		if seconds <= bound {
+			m.loopBuckets[i]++
+		}
+	}
+	m.loopCount++
+	m.loopSum += seconds
+	m.lastLoop = time.Now()
+}
+
+func (m *Metrics) ProcessesScanned(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processes = n
+	m.scans++
+}
+
+func (m *Metrics) GameChanged() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gameChanges++
+}
+
+func (m *Metrics) OutputWriteFailed(err error) {
+	m.mu.Lock()
+	m.outputErrors++
+	m.mu.Unlock()
+	m.SetError(err)
+}
+
+func (m *Metrics) ThumbnailLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.thumbHits++
+	} else {
+		m.thumbMisses++
+	}
+}
+
+// SetError remembers the latest error for /healthz.
+func (m *Metrics) SetError(err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastError = err.Error()
+	m.lastErrorTime = time.Now()
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format.
+// screens are the open WebSocket connections by screen.
+func (m *Metrics) WritePrometheus(w io.Writer, screens map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP trackgamename_detection_loop_duration_seconds Time spent in one pass of the detection loop.")
+	fmt.Fprintln(w, "# TYPE trackgamename_detection_loop_duration_seconds histogram")
+	for i, bound := range loopDurationBuckets {
+		fmt.Fprintf(w, "trackgamename_detection_loop_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.loopBuckets[i])
+	}
+	fmt.Fprintf(w, "trackgamename_detection_loop_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.loopCount)
+	fmt.Fprintf(w, "trackgamename_detection_loop_duration_seconds_sum %g\n", m.loopSum)
+	fmt.Fprintf(w, "trackgamename_detection_loop_duration_seconds_count %d\n", m.loopCount)
+
+	fmt.Fprintln(w, "# HELP trackgamename_detection_heartbeat_age_seconds Seconds since the detection loop last finished a pass.")
+	fmt.Fprintln(w, "# TYPE trackgamename_detection_heartbeat_age_seconds gauge")
+	fmt.Fprintf(w, "trackgamename_detection_heartbeat_age_seconds %g\n", m.heartbeatAge().Seconds())
+
+	fmt.Fprintln(w, "# HELP trackgamename_processes_scanned Processes seen by the last process scan.")
+	fmt.Fprintln(w, "# TYPE trackgamename_processes_scanned gauge")
+	fmt.Fprintf(w, "trackgamename_processes_scanned %d\n", m.processes)
+
+	fmt.Fprintln(w, "# HELP trackgamename_process_scans_total Process list scans.")
+	fmt.Fprintln(w, "# TYPE trackgamename_process_scans_total counter")
+	fmt.Fprintf(w, "trackgamename_process_scans_total %d\n", m.scans)
+
+	fmt.Fprintln(w, "# HELP trackgamename_websocket_clients Open WebSocket connections by screen.")
+	fmt.Fprintln(w, "# TYPE trackgamename_websocket_clients gauge")
+	names := make([]string, 0, len(screens))
+	for screen := range screens {
+		names = append(names, screen)
+	}
+	sort.Strings(names)
+	for _, screen := range names {
+		fmt.Fprintf(w, "trackgamename_websocket_clients{screen=%q} %d\n", screen, screens[screen])
+	}
+
+	fmt.Fprintln(w, "# HELP trackgamename_game_changes_total Times the detected game or system changed.")
+	fmt.Fprintln(w, "# TYPE trackgamename_game_changes_total counter")
+	fmt.Fprintf(w, "trackgamename_game_changes_total %d\n", m.gameChanges)
+
+	fmt.Fprintln(w, "# HELP trackgamename_output_write_failures_total Failed writes of game.txt, console.txt or output.txt.")
+	fmt.Fprintln(w, "# TYPE trackgamename_output_write_failures_total counter")
+	fmt.Fprintf(w, "trackgamename_output_write_failures_total %d\n", m.outputErrors)
+
+	fmt.Fprintln(w, "# HELP trackgamename_thumbnail_lookups_total Thumbnail lookups by result.")
+	fmt.Fprintln(w, "# TYPE trackgamename_thumbnail_lookups_total counter")
+	fmt.Fprintf(w, "trackgamename_thumbnail_lookups_total{result=\"hit\"} %d\n", m.thumbHits)
+	fmt.Fprintf(w, "trackgamename_thumbnail_lookups_total{result=\"miss\"} %d\n", m.thumbMisses)
+}
+
+// heartbeatAge returns how long ago the detection loop finished a pass, or
+// zero if it has not run yet. The caller must hold m.mu.
+func (m *Metrics) heartbeatAge() time.Duration {
+	if m.lastLoop.IsZero() {
+		return 0
+	}
+	return time.Since(m.lastLoop)
+}
+
+// HealthResponse is returned by /healthz.
+type HealthResponse struct {
+	Status              string  `json:"status"`
+	WebServer           bool    `json:"web_server"`
+	DetectionRunning    bool    `json:"detection_running"`
+	HeartbeatAgeSeconds float64 `json:"heartbeat_age_seconds"`
+	LastError           string  `json:"last_error,omitempty"`
+	LastErrorTime       string  `json:"last_error_time,omitempty"`
+}
+
+// Health reports "ok", "starting" before the first detection pass, or
+// "stalled" when the heartbeat is older than heartbeatTimeout.
+func (m *Metrics) Health() (HealthResponse, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := HealthResponse{
+		Status:              "ok",
+		WebServer:           true,
+		DetectionRunning:    !m.lastLoop.IsZero(),
+		HeartbeatAgeSeconds: m.heartbeatAge().Seconds(),
+		LastError:           m.lastError,
+	}
+	if !m.lastErrorTime.IsZero() {
+		res.LastErrorTime = m.lastErrorTime.Format(time.RFC3339)
+	}
+	switch {
+	case m.lastLoop.IsZero():
+		res.Status = "starting"
+		return res, http.StatusServiceUnavailable
+	case m.heartbeatAge() > heartbeatTimeout:
+		res.Status = "stalled"
+		return res, http.StatusServiceUnavailable
+	}
+	return res, http.StatusOK
+}
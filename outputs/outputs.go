@@ -0,0 +1,102 @@
+// Package outputs writes the current game to game.txt and console.txt, or to
+// output.txt, for streaming software that reads text files.
+package outputs
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/tracker"
+)
+
+// Writer keeps the output files in step with a tracker.
+type Writer struct {
+	tracker *tracker.Tracker
+	metrics *metrics.Metrics
+}
+
+// New returns a Writer subscribed to t.
+func New(t *tracker.Tracker, m *metrics.Metrics) *Writer {
+	w := &Writer{tracker: t, metrics: m}
+	t.Subscribe("outputs", w.handle)
+	return w
+}
+
+func (w *Writer) handle(ev tracker.Event) {
+	if !ev.Config.OutputToFiles {
+		return
+	}
+	switch ev.Kind {
+	case tracker.GameStarted, tracker.GameChanged:
+		w.write(w.tracker.OutputDir(), ev.State.Game, ev.State.System, ev.Config.SaveToOneFile)
+	case tracker.GameStopped:
+		w.clear(w.tracker.OutputDir(), ev.Config.SaveToOneFile)
+	}
+}
+
+// Flush writes the last known game to the output files, or clears them when
+// clear_output_on_exit is set.
+func (w *Writer) Flush() {
+	cfg := w.tracker.Config()
+	if !cfg.OutputToFiles {
+		return
+	}
+	if cfg.ClearOutputOnExit {
+		w.clear(w.tracker.OutputDir(), cfg.SaveToOneFile)
+		return
+	}
+	if state := w.tracker.State(); state.Game != "" {
+		w.write(w.tracker.OutputDir(), state.Game, state.System, cfg.SaveToOneFile)
+	}
+}
+
+func (w *Writer) write(savePath, gameName, consoleName string, saveToOneFile bool) {
+	if saveToOneFile {
+		output := consoleName + ": " + gameName
+		if err := os.WriteFile(filepath.Join(savePath, "output.txt"), []byte(output), 0644); err == nil {
+			slog.Debug("Data updated in output.txt", "output", output)
+		} else {
+			slog.Error("Error writing to output.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		}
+	} else {
+		if err := os.WriteFile(filepath.Join(savePath, "game.txt"), []byte(gameName), 0644); err == nil {
+			slog.Debug("Game updated in game.txt", "game", gameName)
+		} else {
+			slog.Error("Error writing to game.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		}
+		if err := os.WriteFile(filepath.Join(savePath, "console.txt"), []byte(consoleName), 0644); err == nil {
+			slog.Debug("System updated in console.txt", "system", consoleName)
+		} else {
+			slog.Error("Error writing to console.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		}
+	}
+}
+
+func (w *Writer) clear(savePath string, saveToOneFile bool) {
+	if saveToOneFile {
+		if err := os.WriteFile(filepath.Join(savePath, "output.txt"), []byte(""), 0644); err != nil {
+			slog.Error("Error clearing output.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		} else {
+			slog.Debug("Data cleared from output.txt")
+		}
+	} else {
+		if err := os.WriteFile(filepath.Join(savePath, "game.txt"), []byte(""), 0644); err != nil {
+			slog.Error("Error clearing game.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		} else {
+			slog.Debug("Data cleared from game.txt")
+		}
+		if err := os.WriteFile(filepath.Join(savePath, "console.txt"), []byte(""), 0644); err != nil {
+			slog.Error("Error clearing console.txt", "err", err)
+			w.metrics.OutputWriteFailed(err)
+		} else {
+			slog.Debug("Data cleared from console.txt")
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/web"
+)
+
+// fileStamp is what the watcher compares to notice that a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// fileWatcher remembers the last seen state of a set of files. It is safe
+// for concurrent use.
+type fileWatcher struct {
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+}
+
+func newFileWatcher() *fileWatcher {
+	return &fileWatcher{stamps: make(map[string]fileStamp)}
+}
+
+// changed reports whether any of paths differs from the previous call. Paths
+// seen for the first time only record their state.
+func (w *fileWatcher) changed(paths []string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := false
+	for _, path := range paths {
+		stamp := statFile(path)
+		if old, known := w.stamps[path]; known && old != stamp {
+			changed = true
+		}
+		w.stamps[path] = stamp
+	}
+	return changed
+}
+
+// write runs fn, which writes path, and records the result as seen, so the
+// program's own changes are not reloaded as if made by hand.
+func (w *fileWatcher) write(path string, fn func() error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := fn()
+	w.stamps[path] = statFile(path)
+	return err
+}
+
+// watchFiles polls config.ini, games.json, the active theme and the active
+// language file and reloads whatever changed until ctx is done. A file that
+// fails validation is logged and the previous good state is kept. Settings
+// saved by the program itself are not reloaded; games.json written by it
+// holds the loaded templates, so reloading it changes nothing.
+func (a *app) watchFiles(ctx context.Context, interval time.Duration) {
+	w := a.files
+	watched := func() (cfgFiles, gamesFiles, themeFiles, langFiles []string) {
+		cfg := a.tracker.Config()
+		cfgFiles = []string{a.currentConfigPath()}
+		gamesFiles = []string{filepath.Join(a.tracker.SavePath(), "games.json")}
+		for _, dir := range []string{filepath.Join(a.dirs.Theme, cfg.Theme), filepath.Join(a.dirs.Theme, "default")} {
+			for _, file := range web.ThemeFiles {
+				themeFiles = append(themeFiles, filepath.Join(dir, file))
+			}
+			themeFiles = append(themeFiles, filepath.Join(dir, "styles.css"))
+		}
+		langFiles = []string{filepath.Join(a.dirs.Lang, cfg.Language+".json")}
+		return
+	}
+	cfgFiles, gamesFiles, themeFiles, langFiles := watched()
+	w.changed(cfgFiles)
+	w.changed(gamesFiles)
+	w.changed(themeFiles)
+	w.changed(langFiles)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cfgFiles, gamesFiles, themeFiles, langFiles = watched()
+		// TemplatesChanged сам обновит открытые страницы настроек
+		if w.changed(gamesFiles) {
+			if err := a.tracker.ReloadTemplates(); err != nil {
+				slog.Error("Error reloading games.json, keeping previous templates", "err", err)
+			}
+		}
+		reloadUI := false
+		if w.changed(cfgFiles) {
+			if err := a.reloadConfig(); err != nil {
+				slog.Error("Error reloading config.ini, keeping previous settings", "err", err)
+			} else {
+				reloadUI = true
+			}
+		}
+		themeChanged := w.changed(themeFiles)
+		langChanged := w.changed(langFiles)
+		if !reloadUI && (themeChanged || langChanged) {
+			if err := a.reloadThemeAndLanguage(); err != nil {
+				slog.Error("Error reloading theme or language, keeping previous", "err", err)
+			} else {
+				reloadUI = true
+			}
+		}
+		if reloadUI {
+			go a.server.NotifyReload()
+		}
+	}
+}
+
+// reloadConfig reads config.ini the way the program does on start, migrating
+// an older file, validates it together with the theme and translations it
+// refers to, and swaps everything in at once.
+func (a *app) reloadConfig() error {
+	path := a.currentConfigPath()
+	// на старте отсутствующий файл создаётся, а здесь это значит, что его удалили
+	if !fsutil.Exists(path) {
+		return fmt.Errorf("%s not found", path)
+	}
+	var newConfig config.Config
+	var migrateErr error
+	// миграция переписывает файл, это не повод перечитывать его ещё раз
+	err := a.files.write(path, func() error {
+		var err error
+		newConfig, migrateErr, err = readConfig(path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(a.dirs.Theme, newConfig.Theme)); err != nil {
+		return fmt.Errorf("theme %s not found", newConfig.Theme)
+	}
+	pages, err := web.ParseTheme(a.dirs.Theme, newConfig.Theme)
+	if err != nil {
+		return err
+	}
+	if _, _, err := i18n.Load(a.dirs.Lang, newConfig.Language); err != nil {
+		return err
+	}
+
+	old := a.tracker.Config()
+	if newConfig.WebPort != old.WebPort {
+		slog.Warn("web_port changed, restart the program to apply", "port", newConfig.WebPort)
+	}
+	if newConfig.BindAddress != old.BindAddress {
+		slog.Warn("bind_address changed, restart the program to apply", "address", newConfig.BindAddress)
+	}
+	if newConfig.HTTPS != old.HTTPS || newConfig.TLSCertFile != old.TLSCertFile || newConfig.TLSKeyFile != old.TLSKeyFile || newConfig.HTTPRedirectPort != old.HTTPRedirectPort {
+		slog.Warn("HTTPS settings changed, restart the program to apply", "https", newConfig.HTTPS)
+	}
+	if old.AgentURL == "" && newConfig.AgentURL != "" {
+		slog.Warn("agent_url was set, restart the program to start sending", "url", newConfig.AgentURL)
+	}
+	if newConfig.SavePath != old.SavePath {
+		slog.Warn("save_path changed, restart the program to apply", "path", newConfig.SavePath)
+	}
+	a.server.SetTheme(pages)
+	a.tracker.ClearFileErrors(path)
+	if migrateErr != nil {
+		slog.Error("Error migrating config.ini, using it as it is", "path", path, "err", migrateErr)
+		a.tracker.AddFileError(path, migrateErr)
+	}
+	a.tracker.SetConfig(newConfig)
+	slog.Info("Reloaded config", "path", path)
+	return nil
+}
+
+// reloadThemeAndLanguage re-parses the active theme after its files changed.
+// Translations are read per request, so the language file only needs checking.
+func (a *app) reloadThemeAndLanguage() error {
+	cfg := a.tracker.Config()
+	pages, err := web.ParseTheme(a.dirs.Theme, cfg.Theme)
+	if err != nil {
+		return err
+	}
+	if _, _, err := i18n.Load(a.dirs.Lang, cfg.Language); err != nil {
+		return err
+	}
+	a.server.SetTheme(pages)
+	slog.Info("Reloaded theme and language", "theme", cfg.Theme, "lang", cfg.Language)
+	return nil
+}
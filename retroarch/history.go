@@ -0,0 +1,106 @@
+// Package retroarch reads what RetroArch is playing from its content history
+// and finds the matching thumbnails.
+package retroarch
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+const (
+	ProcessName = "retroarch.exe"
+	WindowTitle = "RetroArch"
+)
+
+// HistoryPath returns content_history.lpl inside the RetroArch folder.
+func HistoryPath(retroarchPath string) string {
+	return filepath.Join(retroarchPath, "content_history.lpl")
+}
+
+// ReadHistory returns the game and system of the most recent entry in
+// content_history.lpl. The game is the label without region, as it is shown.
+func ReadHistory(fsys fsutil.FS, retroarchPath string) (game, system string, err error) {
+	entry, err := ReadHistoryEntry(fsys, retroarchPath)
+	if err != nil {
+		return "", "", err
+	}
+	return shownName(entry.Label), entry.System, nil
+}
+
+// Entry is the newest item of content_history.lpl with the fields thumbnail
+// lookups need.
+type Entry struct {
+	// Label is the full playlist label, e.g. "Super Mario World (USA)".
+	Label string
+	// Path is the ROM file, e.g. D:\roms\snes\smw.zip.
+	Path string
+	// System is db_name without .lpl, as ReadHistory returns it.
+	System string
+}
+
+// ReadHistoryEntry returns the newest entry of content_history.lpl with the
+// label kept whole.
+func ReadHistoryEntry(fsys fsutil.FS, retroarchPath string) (Entry, error) {
+	lplPath := HistoryPath(retroarchPath)
+	var entry Entry
+	for key, dst := range map[string]*string{"label": &entry.Label, "path": &entry.Path, "db_name": &entry.System} {
+		line, err := findFirstLine(fsys, lplPath, `"`+key+`":`)
+		if err != nil {
+			return Entry{}, err
+		}
+		*dst = lineValue(line, key)
+	}
+	entry.System = cut(entry.System, ".", 0)
+	return entry, nil
+}
+
+// lineValue decodes the string value of key from one line of a playlist,
+// e.g. `    "path": "D:\\roms\\smw.zip",`.
+func lineValue(line, key string) string {
+	line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+	var values map[string]any
+	if err := json.Unmarshal([]byte("{"+line+"}"), &values); err != nil {
+		return ""
+	}
+	value, _ := values[key].(string)
+	return value
+}
+
+func findFirstLine(fsys fsutil.FS, filePath, search string) (string, error) {
+	file, err := fsys.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Warn("failed to close key", "err", err)
+		}
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, search) {
+			return line, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func cut(input, delimiter string, field int) string {
+	parts := strings.Split(input, delimiter)
+	if field < len(parts) {
+		return parts[field]
+	}
+	return ""
+}
+
+// shownName is the part of a label before the region, e.g. "Super Mario
+// World" for "Super Mario World (USA)".
+func shownName(label string) string {
+	return strings.TrimSpace(strings.Split(label, "(")[0])
+}
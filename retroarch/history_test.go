@@ -0,0 +1,107 @@
+package retroarch
+
+import (
+	"fmt"
+	"testing"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+// writeHistory writes a content_history.lpl whose newest entry is the given
+// game. path must already be escaped for JSON.
+func writeHistory(t *testing.T, fsys fsutil.FS, retroarchPath, label, path, dbName string) {
+	t.Helper()
+	lpl := fmt.Sprintf(`{
+  "version": "1.5",
+  "items": [
+    {
+      "path": "%s",
+      "label": "%s",
+      "core_path": "DETECT",
+      "core_name": "DETECT",
+      "crc32": "DETECT",
+      "db_name": "%s"
+    },
+    {
+      "path": "D:\\roms\\older.zip",
+      "label": "Older Game",
+      "db_name": "Sega - Mega Drive - Genesis.lpl"
+    }
+  ]
+}
+`, path, label, dbName)
+	if err := fsys.WriteFile(HistoryPath(retroarchPath), []byte(lpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadHistoryEntry(t *testing.T) {
+	tests := []struct {
+		name            string
+		label, path, db string
+		want            Entry
+		game            string
+	}{
+		{
+			name:  "escaped path",
+			label: "Super Mario World (USA)", path: `D:\\roms\\snes\\smw.zip#smw.sfc`, db: "Nintendo - Super Nintendo Entertainment System.lpl",
+			want: Entry{Label: "Super Mario World (USA)", Path: `D:\roms\snes\smw.zip#smw.sfc`, System: "Nintendo - Super Nintendo Entertainment System"},
+			game: "Super Mario World",
+		},
+		{
+			name:  "quotes and unicode escapes",
+			label: `Game \"Quoted\" \u00e9dition (Europe)`, path: "/roms/game.bin", db: "Sony - PlayStation.lpl",
+			want: Entry{Label: `Game "Quoted" édition (Europe)`, Path: "/roms/game.bin", System: "Sony - PlayStation"},
+			game: `Game "Quoted" édition`,
+		},
+		{
+			name:  "label without region",
+			label: "Tetris", path: "tetris.gb", db: "Nintendo - Game Boy.lpl",
+			want: Entry{Label: "Tetris", Path: "tetris.gb", System: "Nintendo - Game Boy"},
+			game: "Tetris",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fsutil.NewMemFS()
+			writeHistory(t, fsys, "retroarch", tt.label, tt.path, tt.db)
+			got, err := ReadHistoryEntry(fsys, "retroarch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadHistoryEntry() = %+v, want %+v", got, tt.want)
+			}
+			game, system, err := ReadHistory(fsys, "retroarch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game != tt.game || system != tt.want.System {
+				t.Errorf("ReadHistory() = %q, %q, want %q, %q", game, system, tt.game, tt.want.System)
+			}
+		})
+	}
+
+	if _, err := ReadHistoryEntry(fsutil.NewMemFS(), "retroarch"); err == nil {
+		t.Error("missing content_history.lpl gave no error")
+	}
+}
+
+func TestLineValue(t *testing.T) {
+	tests := []struct {
+		line, key, want string
+	}{
+		{`      "label": "Super Mario World (USA)",`, "label", "Super Mario World (USA)"},
+		{`"path": "D:\\roms\\smw.zip"`, "path", `D:\roms\smw.zip`},
+		{`"label": "Comma, in the name",`, "label", "Comma, in the name"},
+		{`"label": "\u041c\u0430\u0440\u0438\u043e",`, "label", "Марио"},
+		{`"label": 5,`, "label", ""},
+		{`"label": "broken`, "label", ""},
+		{`"path": "a.zip",`, "label", ""},
+	}
+	for _, tt := range tests {
+		if got := lineValue(tt.line, tt.key); got != tt.want {
+			t.Errorf("lineValue(%q, %q) = %q, want %q", tt.line, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package retroarch
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+// ThumbnailTypes are the thumbnail types of thumbnail_types and
+// /thumbnails?type=, in RetroArch's order.
+var ThumbnailTypes = []string{"title", "boxart", "snap", "logo"}
+
+var thumbnailFolders = map[string]string{
+	"title":  "Named_Titles",
+	"boxart": "Named_Boxarts",
+	"snap":   "Named_Snaps",
+	"logo":   "Named_Logos",
+}
+
+// ThumbnailFolder returns the folder of a thumbnail type, e.g. Named_Boxarts
+// for "boxart".
+func ThumbnailFolder(thumbnailType string) (string, bool) {
+	folder, ok := thumbnailFolders[thumbnailType]
+	return folder, ok
+}
+
+// ThumbnailFolders returns the folders of types in the same order, skipping
+// unknown types.
+func ThumbnailFolders(types []string) []string {
+	var folders []string
+	for _, t := range types {
+		if folder, ok := thumbnailFolders[t]; ok {
+			folders = append(folders, folder)
+		}
+	}
+	return folders
+}
+
+// ThumbnailQuery describes the game to find thumbnails for. Label and Path
+// are optional and widen the search.
+type ThumbnailQuery struct {
+	System string
+	// Game is the name shown, often the label without region.
+	Game string
+	// Label is the full playlist label.
+	Label string
+	// Path is the ROM file from the playlist.
+	Path string
+}
+
+// QueryFromHistory returns the query for game on system. When the newest
+// content history entry is that game, its full label and ROM path are added,
+// since RetroArch names thumbnails after them rather than after the shortened
+// name that is shown.
+func QueryFromHistory(fsys fsutil.FS, retroarchPath, system, game string) ThumbnailQuery {
+	q := ThumbnailQuery{System: strings.TrimSpace(system), Game: strings.TrimSpace(game)}
+	if retroarchPath == "" || q.System == "" || q.Game == "" {
+		return q
+	}
+	entry, err := ReadHistoryEntry(fsys, retroarchPath)
+	if err != nil || entry.System != q.System {
+		return q
+	}
+	if label := strings.TrimSpace(entry.Label); label == q.Game || shownName(label) == q.Game {
+		q.Label, q.Path = label, entry.Path
+	}
+	return q
+}
+
+// thumbnailCandidate is a file name to try and the strategy it comes from.
+type thumbnailCandidate struct {
+	strategy string
+	name     string
+}
+
+// candidates lists the names RetroArch could have used for q, best first:
+// the full label, the shown name, the ROM file name and the label without
+// region and revision tags.
+func (q ThumbnailQuery) candidates() []thumbnailCandidate {
+	var list []thumbnailCandidate
+	add := func(strategy, name string) {
+		if strings.TrimSpace(name) == "" {
+			return
+		}
+		name = ThumbnailName(name)
+		for _, c := range list {
+			if c.name == name {
+				return
+			}
+		}
+		list = append(list, thumbnailCandidate{strategy, name})
+	}
+	add("label", q.Label)
+	add("game", q.Game)
+	add("rom", romName(q.Path))
+	if q.Label != "" {
+		add("short", shortName(q.Label))
+	}
+	add("short", shortName(q.Game))
+	return list
+}
+
+// FindThumbnails returns the images of the game in q that exist under
+// thumbnailsPath, at most one per folder in kinds and in that order, as paths
+// relative to it with forward slashes. Each kind tries the names from q in
+// order and then the same names ignoring case.
+func FindThumbnails(fsys fsutil.FS, thumbnailsPath string, q ThumbnailQuery, kinds []string) []string {
+	system := strings.TrimSpace(q.System)
+	if system == "" || strings.TrimSpace(q.Game) == "" {
+		return nil
+	}
+	candidates := q.candidates()
+	var found []string
+	for _, kind := range kinds {
+		dir := filepath.Join(thumbnailsPath, system, kind)
+		name, strategy := findThumbnail(fsys, dir, candidates)
+		if name == "" {
+			slog.Debug("Thumbnail not found", "system", system, "game", q.Game, "kind", kind)
+			continue
+		}
+		slog.Debug("Thumbnail found", "system", system, "game", q.Game, "kind", kind, "file", name, "strategy", strategy)
+		found = append(found, fmt.Sprintf("%s/%s/%s", system, kind, name))
+	}
+	return found
+}
+
+// findThumbnail returns the file in dir matching the first candidate that
+// exists, and the strategy that found it.
+func findThumbnail(fsys fsutil.FS, dir string, candidates []thumbnailCandidate) (string, string) {
+	for _, c := range candidates {
+		if _, err := fsys.Stat(filepath.Join(dir, c.name+".png")); err == nil {
+			return c.name + ".png", c.strategy
+		}
+	}
+	// регистр букв в паках обложек часто отличается от плейлиста
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return "", ""
+	}
+	for _, c := range candidates {
+		for _, e := range entries {
+			base, ok := strings.CutSuffix(e.Name(), ".png")
+			if ok && !e.IsDir() && strings.EqualFold(base, c.name) {
+				return e.Name(), c.strategy + ", case-insensitive"
+			}
+		}
+	}
+	return "", ""
+}
+
+// romName returns the ROM file name without folder and extension. For files
+// inside archives ("smw.zip#smw.sfc") the file inside is used.
+func romName(path string) string {
+	if i := strings.LastIndexAny(path, `/\#`); i >= 0 {
+		path = path[i+1:]
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// shortName cuts the region and revision tags off a label, e.g.
+// "Super Mario World (USA) [!]" becomes "Super Mario World".
+func shortName(label string) string {
+	if i := strings.IndexAny(label, "(["); i >= 0 {
+		label = label[:i]
+	}
+	return strings.TrimSpace(label)
+}
+
+// thumbnailReplacer applies RetroArch's rule for thumbnail file names: each
+// of &*/:`<>?\|" becomes an underscore.
+var thumbnailReplacer = strings.NewReplacer(
+	"&", "_", "*", "_", "/", "_", ":", "_", "`", "_",
+	"<", "_", ">", "_", "?", "_", `\`, "_", "|", "_", `"`, "_",
+)
+
+// ThumbnailName turns a game or system name into the base name RetroArch
+// looks for, without the .png extension. The result is always a single
+// path element.
+func ThumbnailName(name string) string {
+	name = thumbnailReplacer.Replace(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, name)
+	// Windows не создаёт файлы с точкой или пробелом в конце имени
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,157 @@
+package retroarch
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+func TestFindThumbnails(t *testing.T) {
+	const root = "thumbnails"
+	const snes = "Nintendo - Super Nintendo Entertainment System"
+	fsys := fsutil.NewMemFS()
+	for _, rel := range []string{
+		snes + "/Named_Titles/Super Mario World (USA).png",
+		snes + "/Named_Boxarts/Super Mario World.png",
+		snes + "/Named_Snaps/smw.png",
+		snes + "/Named_Titles/DONKEY KONG COUNTRY.png",
+		snes + "/Named_Titles/Q_bert 3.png",
+		"Sega - Mega Drive - Genesis/Named_Titles/Sonic the Hedgehog.png",
+	} {
+		if err := fsys.WriteFile(filepath.Join(root, filepath.FromSlash(rel)), []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query ThumbnailQuery
+		kinds []string
+		want  []string
+	}{
+		{
+			name:  "full label first, then the shown name",
+			query: ThumbnailQuery{System: snes, Game: "Super Mario World", Label: "Super Mario World (USA)"},
+			kinds: []string{"Named_Titles", "Named_Boxarts"},
+			want:  []string{snes + "/Named_Titles/Super Mario World (USA).png", snes + "/Named_Boxarts/Super Mario World.png"},
+		},
+		{
+			name:  "order of kinds is kept",
+			query: ThumbnailQuery{System: snes, Game: "Super Mario World", Label: "Super Mario World (USA)"},
+			kinds: []string{"Named_Boxarts", "Named_Titles"},
+			want:  []string{snes + "/Named_Boxarts/Super Mario World.png", snes + "/Named_Titles/Super Mario World (USA).png"},
+		},
+		{
+			name:  "rom file name",
+			query: ThumbnailQuery{System: snes, Game: "Super Mario World", Path: `D:\roms\snes\smw.zip#smw.sfc`},
+			kinds: []string{"Named_Snaps"},
+			want:  []string{snes + "/Named_Snaps/smw.png"},
+		},
+		{
+			name:  "label without region tags",
+			query: ThumbnailQuery{System: snes, Game: "Super Mario World (Europe) [!]"},
+			kinds: []string{"Named_Boxarts"},
+			want:  []string{snes + "/Named_Boxarts/Super Mario World.png"},
+		},
+		{
+			name:  "different case",
+			query: ThumbnailQuery{System: snes, Game: "Donkey Kong Country"},
+			kinds: []string{"Named_Titles"},
+			want:  []string{snes + "/Named_Titles/DONKEY KONG COUNTRY.png"},
+		},
+		{
+			name:  "characters RetroArch replaces",
+			query: ThumbnailQuery{System: snes, Game: "Q*bert 3"},
+			kinds: []string{"Named_Titles"},
+			want:  []string{snes + "/Named_Titles/Q_bert 3.png"},
+		},
+		{
+			name:  "missing kind is skipped",
+			query: ThumbnailQuery{System: "Sega - Mega Drive - Genesis", Game: "Sonic the Hedgehog"},
+			kinds: []string{"Named_Boxarts", "Named_Titles"},
+			want:  []string{"Sega - Mega Drive - Genesis/Named_Titles/Sonic the Hedgehog.png"},
+		},
+		{
+			name:  "unknown game",
+			query: ThumbnailQuery{System: snes, Game: "Chrono Trigger"},
+			kinds: []string{"Named_Titles", "Named_Boxarts"},
+		},
+		{
+			name:  "no system",
+			query: ThumbnailQuery{Game: "Super Mario World"},
+			kinds: []string{"Named_Boxarts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindThumbnails(fsys, root, tt.query, tt.kinds)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindThumbnails() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFromHistory(t *testing.T) {
+	fsys := fsutil.NewMemFS()
+	writeHistory(t, fsys, "retroarch", "Super Mario World (USA)", `D:\\roms\\smw.zip`, "Nintendo - Super Nintendo Entertainment System.lpl")
+	const snes = "Nintendo - Super Nintendo Entertainment System"
+
+	tests := []struct {
+		name          string
+		system, game  string
+		label, romDir string
+	}{
+		{"shown name of the newest entry", snes, "Super Mario World", "Super Mario World (USA)", `D:\roms\smw.zip`},
+		{"full label of the newest entry", snes, "Super Mario World (USA)", "Super Mario World (USA)", `D:\roms\smw.zip`},
+		{"another game", snes, "Chrono Trigger", "", ""},
+		{"another system", "Sega - Mega Drive - Genesis", "Super Mario World", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := QueryFromHistory(fsys, "retroarch", tt.system, tt.game)
+			if q.Label != tt.label || q.Path != tt.romDir || q.Game != tt.game {
+				t.Errorf("QueryFromHistory() = %+v", q)
+			}
+		})
+	}
+}
+
+func TestShortName(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"Super Mario World (USA)", "Super Mario World"},
+		{"Super Mario World (USA) [!]", "Super Mario World"},
+		{"Chrono Trigger [T+Rus]", "Chrono Trigger"},
+		{"  Tetris  ", "Tetris"},
+		{"(Prototype)", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := shortName(tt.label); got != tt.want {
+			t.Errorf("shortName(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestThumbnailName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Super Mario World", "Super Mario World"},
+		{`Q*bert: "Qubes" <&> a/b\c|d?e` + "`", `Q_bert_ _Qubes_ ___ a_b_c_d_e_`},
+		{"Tab\tand\x7fdelete", "Tab_and_delete"},
+		{"Game...", "Game"},
+		{"  Game  ", "Game"},
+		{"...", "_"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		if got := ThumbnailName(tt.name); got != tt.want {
+			t.Errorf("ThumbnailName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
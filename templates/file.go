@@ -0,0 +1,142 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+// SchemaVersion is the current games.json format. Bump it together with a new
+// step in migrate.
+const SchemaVersion = 2
+
+// gamesFile is the versioned layout of games.json. Version 1 was a bare array.
+type gamesFile struct {
+	Version   int        `json:"version"`
+	Templates []Template `json:"templates"`
+}
+
+// Decode parses any known games.json layout and returns the templates
+// together with the version they were stored in.
+func Decode(data []byte) ([]Template, int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, SchemaVersion, nil
+	}
+	if data[0] == '[' {
+		var templates []Template
+		if err := json.Unmarshal(data, &templates); err != nil {
+			return nil, 1, err
+		}
+		return templates, 1, nil
+	}
+	var file gamesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, 0, err
+	}
+	if file.Version > SchemaVersion {
+		return nil, file.Version, fmt.Errorf("games.json version %d is newer than supported version %d", file.Version, SchemaVersion)
+	}
+	if file.Version < 2 {
+		return nil, file.Version, fmt.Errorf("unknown games.json version %d", file.Version)
+	}
+	return file.Templates, file.Version, nil
+}
+
+// migrate upgrades templates stored in an older games.json version.
+func migrate(templates []Template, from int) []Template {
+	if from < 2 {
+		// v1 -> v2: убираем служебный шаблон RetroArch, который раньше
+		// сохранялся в файл, переводим пути в формат с "/" и выдаём ID
+		migrated := make([]Template, 0, len(templates))
+		for _, tmpl := range templates {
+			if strings.EqualFold(tmpl.ProcessName, "retroarch.exe") && tmpl.Game == "" {
+				continue
+			}
+			tmpl.NamedTitles = normalizeThumbnailPath(tmpl.NamedTitles)
+			tmpl.NamedBoxarts = normalizeThumbnailPath(tmpl.NamedBoxarts)
+			migrated = append(migrated, tmpl)
+		}
+		templates = migrated
+		EnsureIDs(templates)
+	}
+	return templates
+}
+
+// normalizeThumbnailPath stores thumbnail paths relative to thumbnails_path
+// with forward slashes, so they work both on disk and in /thumbnails URLs.
+func normalizeThumbnailPath(path string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(path, `\`, "/"), "/")
+}
+
+// Load reads games.json at path, creating an empty one on the first start.
+// The built-in RetroArch template is not part of the result.
+func Load(fsys fsutil.FS, path string) ([]Template, error) {
+	if _, err := fsys.Stat(path); os.IsNotExist(err) {
+		if err := Save(fsys, path, nil); err != nil {
+			return nil, fmt.Errorf("error creating games.json: %v", err)
+		}
+		slog.Info("Created empty games.json")
+		return nil, nil
+	}
+	templates, err := Read(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Loaded game templates from games.json")
+	return templates, nil
+}
+
+// Read parses an existing games.json, also after it was edited by hand. Older
+// versions are migrated after backing them up, and the file is written back
+// when that or new template IDs changed it, so the IDs stay the same on the
+// next read.
+func Read(fsys fsutil.FS, path string) ([]Template, error) {
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading games.json: %v", err)
+	}
+	templates, version, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if version < SchemaVersion {
+		backup, err := fsutil.BackupFile(fsys, path, version)
+		if err != nil {
+			return nil, fmt.Errorf("cannot back up before migration: %v", err)
+		}
+		templates = migrate(templates, version)
+		slog.Info("Migrated games.json", "from", version, "to", SchemaVersion, "backup", backup)
+	}
+	if EnsureIDs(templates) || version < SchemaVersion {
+		if err := Save(fsys, path, templates); err != nil {
+			slog.Error("Error saving games.json", "err", err)
+		}
+	}
+	return templates, nil
+}
+
+// Save writes templates to games.json, leaving out the built-in RetroArch
+// template.
+func Save(fsys fsutil.FS, path string, templates []Template) error {
+	file := gamesFile{Version: SchemaVersion, Templates: []Template{}}
+	for _, tmpl := range RemoveDuplicates(templates) {
+		if tmpl.ID != RetroarchID {
+			file.Templates = append(file.Templates, tmpl)
+		}
+	}
+	data, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling game templates: %v", err)
+	}
+	if err := fsys.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing games.json: %v", err)
+	}
+	slog.Debug("Saved game templates to games.json")
+	return nil
+}
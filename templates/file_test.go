@@ -0,0 +1,158 @@
+package templates
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"WatchdogRetroArch/internal/fsutil"
+)
+
+func readFile(t *testing.T, fsys fsutil.FS, path string) gamesFile {
+	t.Helper()
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file gamesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("games.json is not the current format: %v\n%s", err, data)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join("save", "games.json")
+	tests := []struct {
+		name    string
+		content string // пусто: файла нет
+		want    []Template
+		wantErr string
+		backup  bool
+	}{
+		{
+			name: "first start",
+		},
+		{
+			name:    "current version",
+			content: `{"version": 2, "templates": [{"id": "a", "process_name": "Game.exe", "game": "Game", "priority": 3}]}`,
+			want:    []Template{{ID: "a", ProcessName: "Game.exe", Game: "Game", Priority: 3}},
+		},
+		{
+			name:    "version 1 array",
+			content: `[{"process_name": "retroarch.exe", "window_title": "RetroArch"}, {"process_name": "Game.exe", "game": "Game", "named_titles": "\\Windows\\Named_Titles\\Game.png"}]`,
+			want:    []Template{{ProcessName: "Game.exe", Game: "Game", NamedTitles: "Windows/Named_Titles/Game.png"}},
+			backup:  true,
+		},
+		{
+			name:    "newer version",
+			content: `{"version": 99, "templates": []}`,
+			wantErr: "newer than supported",
+		},
+		{
+			name:    "broken",
+			content: `{"version": 2, "templates": [`,
+			wantErr: "unexpected end",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fsutil.NewMemFS()
+			if tt.content != "" {
+				if err := fsys.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := Load(fsys, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				if data, _ := fsys.ReadFile(path); string(data) != tt.content {
+					t.Error("a file that failed to load was overwritten")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Load() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].ID == "" {
+					t.Errorf("template %d has no ID", i)
+				}
+				want := tt.want[i]
+				if want.ID == "" {
+					want.ID = got[i].ID
+				}
+				if got[i] != want {
+					t.Errorf("template %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+			// ID, выданные при загрузке, сохранены в файл
+			file := readFile(t, fsys, path)
+			if file.Version != SchemaVersion || len(file.Templates) != len(got) {
+				t.Fatalf("saved games.json = %+v", file)
+			}
+			for i := range got {
+				if file.Templates[i] != got[i] {
+					t.Errorf("saved template %d = %+v, want %+v", i, file.Templates[i], got[i])
+				}
+			}
+			_, err = fsys.Stat(path + ".v1.bak")
+			if (err == nil) != tt.backup {
+				t.Errorf("backup exists = %v, want %v", err == nil, tt.backup)
+			}
+		})
+	}
+}
+
+func TestReadKeepsIDs(t *testing.T) {
+	fsys := fsutil.NewMemFS()
+	path := "games.json"
+	if err := fsys.WriteFile(path, []byte(`{"version": 2, "templates": [{"process_name": "Game.exe"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Read(fsys, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Read(fsys, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first[0].ID == "" || first[0].ID != second[0].ID {
+		t.Errorf("IDs differ between reads: %q, %q", first[0].ID, second[0].ID)
+	}
+	if _, err := Read(fsys, "missing.json"); err == nil {
+		t.Error("Read created a missing games.json")
+	}
+}
+
+func TestSave(t *testing.T) {
+	fsys := fsutil.NewMemFS()
+	list := []Template{
+		{ID: "a", ProcessName: "Game.exe", Game: "Old"},
+		NewRetroarch(),
+		{ID: "b", ProcessName: "Game.exe", Game: "New"},
+		{ID: "c", ProcessName: "Other.exe"},
+	}
+	if err := Save(fsys, "games.json", list); err != nil {
+		t.Fatal(err)
+	}
+	file := readFile(t, fsys, "games.json")
+	want := []Template{{ID: "b", ProcessName: "Game.exe", Game: "New"}, {ID: "c", ProcessName: "Other.exe"}}
+	if len(file.Templates) != len(want) || file.Templates[0] != want[0] || file.Templates[1] != want[1] {
+		t.Errorf("saved templates = %+v, want %+v", file.Templates, want)
+	}
+
+	if err := Save(fsys, "empty.json", nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := fsys.ReadFile("empty.json"); !strings.Contains(string(data), `"templates": []`) {
+		t.Errorf("empty games.json = %s, want an empty array", data)
+	}
+}
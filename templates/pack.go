@@ -0,0 +1,312 @@
+package templates
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"WatchdogRetroArch/retroarch"
+)
+
+// PackVersion is the current template pack format. Bump it together with a
+// change to packFile.
+const PackVersion = 1
+
+const (
+	packManifest = "pack.json"
+	packImageDir = "thumbnails/"
+	// maxPackImages limits how many images a pack may carry.
+	maxPackImages = 2000
+)
+
+// Conflict modes of Import for a pack template whose process name and window
+// title are already used by a template.
+const (
+	ConflictSkip      = "skip"      // keep the existing template
+	ConflictOverwrite = "overwrite" // replace it, keeping its ID
+	ConflictRename    = "rename"    // add the pack template under a free window title
+)
+
+var ConflictModes = []string{ConflictSkip, ConflictOverwrite, ConflictRename}
+
+// Pack is a set of templates shared between users, together with the
+// thumbnails their NamedTitles and NamedBoxarts point to. Images are keyed
+// by the same path relative to thumbnails_path.
+type Pack struct {
+	Templates []Template
+	Images    map[string][]byte
+}
+
+// packFile is pack.json inside the archive.
+type packFile struct {
+	Version   int        `json:"version"`
+	Templates []Template `json:"templates"`
+}
+
+// WritePack stores pack as a zip archive with pack.json and the images under
+// thumbnails/.
+func WritePack(w io.Writer, pack Pack) error {
+	zw := zip.NewWriter(w)
+	manifest, err := zw.Create(packManifest)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(packFile{Version: PackVersion, Templates: pack.Templates}); err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for _, tmpl := range pack.Templates {
+		for _, rel := range []string{tmpl.NamedTitles, tmpl.NamedBoxarts} {
+			data, ok := pack.Images[rel]
+			if rel == "" || !ok || written[rel] {
+				continue
+			}
+			written[rel] = true
+			// PNG уже сжат, поэтому кладём без сжатия
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: packImageDir + rel, Method: zip.Store})
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// ReadPack reads an archive written by WritePack. Images larger than
+// maxImageSize are rejected, files that no template refers to are ignored.
+func ReadPack(r io.ReaderAt, size int64, maxImageSize int64) (Pack, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Pack{}, fmt.Errorf("not a template pack: %v", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	manifest, ok := files[packManifest]
+	if !ok {
+		return Pack{}, fmt.Errorf("not a template pack: %s is missing", packManifest)
+	}
+	data, err := readPackFile(manifest, 1<<20)
+	if err != nil {
+		return Pack{}, err
+	}
+	var file packFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return Pack{}, fmt.Errorf("invalid %s: %v", packManifest, err)
+	}
+	if file.Version < 1 || file.Version > PackVersion {
+		return Pack{}, fmt.Errorf("template pack version %d is not supported, at most %d is", file.Version, PackVersion)
+	}
+
+	pack := Pack{Images: make(map[string][]byte)}
+	for _, tmpl := range file.Templates {
+		if tmpl.ID == RetroarchID {
+			continue
+		}
+		tmpl.NamedTitles = normalizeThumbnailPath(tmpl.NamedTitles)
+		tmpl.NamedBoxarts = normalizeThumbnailPath(tmpl.NamedBoxarts)
+		for _, rel := range []string{tmpl.NamedTitles, tmpl.NamedBoxarts} {
+			if rel == "" {
+				continue
+			}
+			if _, done := pack.Images[rel]; done {
+				continue
+			}
+			if !ValidThumbnailPath(rel) {
+				return Pack{}, fmt.Errorf("invalid thumbnail path %q", rel)
+			}
+			f, ok := files[packImageDir+rel]
+			if !ok {
+				continue // шаблон без картинки всё равно можно импортировать
+			}
+			if len(pack.Images) >= maxPackImages {
+				return Pack{}, fmt.Errorf("template pack has more than %d images", maxPackImages)
+			}
+			img, err := readPackFile(f, maxImageSize)
+			if err != nil {
+				return Pack{}, err
+			}
+			pack.Images[rel] = img
+		}
+		pack.Templates = append(pack.Templates, tmpl)
+	}
+	return pack, nil
+}
+
+// ValidThumbnailPath reports whether rel is "<system>/<folder>/<name>.png"
+// with system and name already following RetroArch's naming rules, so it
+// cannot point outside thumbnails_path.
+func ValidThumbnailPath(rel string) bool {
+	parts := strings.Split(rel, "/")
+	if len(parts) != 3 || path.Ext(parts[2]) != ".png" {
+		return false
+	}
+	name := strings.TrimSuffix(parts[2], ".png")
+	if parts[1] == "" || parts[1] == "." || parts[1] == ".." || strings.ContainsAny(parts[1], `\:`) {
+		return false
+	}
+	return parts[0] == retroarch.ThumbnailName(parts[0]) && name == retroarch.ThumbnailName(name)
+}
+
+func readPackFile(f *zip.File, limit int64) ([]byte, error) {
+	if int64(f.UncompressedSize64) > limit {
+		return nil, fmt.Errorf("%s in the pack is larger than %d bytes", f.Name, limit)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from the pack: %v", f.Name, err)
+	}
+	defer rc.Close()
+	// размер в заголовке может врать, поэтому ограничиваем и само чтение
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from the pack: %v", f.Name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s in the pack is larger than %d bytes", f.Name, limit)
+	}
+	return data, nil
+}
+
+// Import actions reported for every template of a pack.
+const (
+	ActionAdd       = "add"
+	ActionOverwrite = "overwrite"
+	ActionRename    = "rename"
+	ActionSkip      = "skip"
+	ActionInvalid   = "invalid"
+)
+
+// ImportResult tells what Import did, or would do, with one pack template.
+// Images maps the paths of the images to write, relative to thumbnails_path,
+// to their path in the pack.
+type ImportResult struct {
+	ProcessName string            `json:"process_name"`
+	WindowTitle string            `json:"window_title"`
+	Action      string            `json:"action"`
+	ID          string            `json:"id,omitempty"`
+	RenamedTo   string            `json:"renamed_to,omitempty"`
+	Errors      map[string]string `json:"errors,omitempty"`
+	Images      map[string]string `json:"images,omitempty"`
+}
+
+var errUnknownConflictMode = errors.New("conflict must be skip, overwrite or rename")
+
+// Import merges the templates of pack into list and returns the new list and
+// what happened to every pack template. A pack template conflicts with an
+// existing one that has the same Key; mode decides which one is kept. Added
+// templates get new IDs, so IDs from another computer never clash.
+func Import(list []Template, pack Pack, mode string) ([]Template, []ImportResult, error) {
+	switch mode {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, nil, errUnknownConflictMode
+	}
+	result := append([]Template(nil), list...)
+	var report []ImportResult
+	for _, tmpl := range pack.Templates {
+		res := ImportResult{ProcessName: tmpl.ProcessName, WindowTitle: tmpl.WindowTitle}
+		existing := findKey(result, tmpl)
+		switch {
+		case existing >= 0 && result[existing].ID == RetroarchID:
+			res.Action = ActionSkip
+		case existing >= 0 && mode == ConflictSkip:
+			res.Action = ActionSkip
+			res.ID = result[existing].ID
+		case existing >= 0 && mode == ConflictOverwrite:
+			tmpl.ID = result[existing].ID
+			res.Action = ActionOverwrite
+		case existing >= 0 && mode == ConflictRename:
+			tmpl.ID = NewID()
+			tmpl.WindowTitle = freeTitle(result, tmpl)
+			res.Action = ActionRename
+			res.RenamedTo = tmpl.WindowTitle
+		default:
+			tmpl.ID = NewID()
+			res.Action = ActionAdd
+		}
+		if res.Action == ActionSkip {
+			report = append(report, res)
+			continue
+		}
+
+		images := make(map[string]string)
+		renamed := res.Action == ActionRename
+		tmpl.NamedTitles = importImage(tmpl.NamedTitles, tmpl, renamed, pack, images)
+		tmpl.NamedBoxarts = importImage(tmpl.NamedBoxarts, tmpl, renamed, pack, images)
+		if fields := Validate(&tmpl, result); len(fields) > 0 {
+			res.Action = ActionInvalid
+			res.Errors = fields
+			report = append(report, res)
+			continue
+		}
+		res.ID = tmpl.ID
+		if len(images) > 0 {
+			res.Images = images
+		}
+		if res.Action == ActionOverwrite {
+			result[existing] = tmpl
+		} else {
+			result = append(result, tmpl)
+		}
+		report = append(report, res)
+	}
+	return result, report, nil
+}
+
+func findKey(list []Template, tmpl Template) int {
+	for i, other := range list {
+		if Key(other) == Key(tmpl) {
+			return i
+		}
+	}
+	return -1
+}
+
+// freeTitle returns "<title> (2)", "<title> (3)", ... whichever is not used
+// by another template of the same process. Without a window title the game
+// name is the base, because that is what would be shown.
+func freeTitle(list []Template, tmpl Template) string {
+	base := tmpl.WindowTitle
+	if base == "" {
+		base = tmpl.Game
+	}
+	if base == "" {
+		base = strings.TrimSuffix(tmpl.ProcessName, ".exe")
+	}
+	for n := 2; ; n++ {
+		tmpl.WindowTitle = fmt.Sprintf("%s (%d)", base, n)
+		if findKey(list, tmpl) < 0 {
+			return tmpl.WindowTitle
+		}
+	}
+}
+
+// importImage decides where the pack image at rel goes and records it in
+// images. A renamed template gets its images under the new title, which is
+// the name thumbnails are looked up by.
+func importImage(rel string, tmpl Template, renamed bool, pack Pack, images map[string]string) string {
+	if rel == "" {
+		return ""
+	}
+	if _, ok := pack.Images[rel]; !ok {
+		return rel
+	}
+	dst := rel
+	if renamed {
+		dir, _ := path.Split(rel)
+		dst = dir + retroarch.ThumbnailName(tmpl.WindowTitle) + ".png"
+	}
+	images[dst] = rel
+	return dst
+}
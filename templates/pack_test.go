@@ -0,0 +1,213 @@
+package templates
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func writeTestPack(t *testing.T, pack Pack) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WritePack(&buf, pack); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	pack := Pack{
+		Templates: []Template{
+			{ID: "a1", ProcessName: "Game.exe", WindowTitle: "Game", System: "Windows", Game: "Game",
+				NamedTitles: "Windows/Named_Titles/Game.png", NamedBoxarts: "Windows/Named_Boxarts/Game.png"},
+			{ID: "b2", ProcessName: "Other.exe", System: "Windows", Game: "Other",
+				NamedTitles: "Windows/Named_Titles/Game.png"},
+		},
+		Images: map[string][]byte{
+			"Windows/Named_Titles/Game.png":  []byte("title"),
+			"Windows/Named_Boxarts/Game.png": []byte("boxart"),
+		},
+	}
+	r := writeTestPack(t, pack)
+	got, err := ReadPack(r, r.Size(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Templates) != 2 || got.Templates[0] != pack.Templates[0] || got.Templates[1] != pack.Templates[1] {
+		t.Errorf("templates = %+v", got.Templates)
+	}
+	for rel, data := range pack.Images {
+		if string(got.Images[rel]) != string(data) {
+			t.Errorf("image %s = %q, want %q", rel, got.Images[rel], data)
+		}
+	}
+}
+
+func TestReadPackRejects(t *testing.T) {
+	zipWith := func(files map[string]string) *bytes.Reader {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			f, _ := zw.Create(name)
+			f.Write([]byte(content))
+		}
+		zw.Close()
+		return bytes.NewReader(buf.Bytes())
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"not a pack", map[string]string{"games.json": "[]"}, "pack.json is missing"},
+		{"newer version", map[string]string{"pack.json": `{"version": 99}`}, "not supported"},
+		{"broken manifest", map[string]string{"pack.json": `{`}, "invalid pack.json"},
+		{
+			"path outside thumbnails",
+			map[string]string{"pack.json": `{"version":1,"templates":[{"process_name":"a.exe","named_titles":"../../evil.png"}]}`},
+			"invalid thumbnail path",
+		},
+		{
+			"image too large",
+			map[string]string{
+				"pack.json":                             `{"version":1,"templates":[{"process_name":"a.exe","named_titles":"Windows/Named_Titles/a.png"}]}`,
+				"thumbnails/Windows/Named_Titles/a.png": strings.Repeat("x", 2000),
+			},
+			"larger than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := zipWith(tt.files)
+			_, err := ReadPack(r, r.Size(), 1000)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ReadPack() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidThumbnailPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Windows/Named_Titles/Game.png", true},
+		{"Nintendo - Super Nintendo Entertainment System/Named_Boxarts/Q_bert's Qubes.png", true},
+		{"Windows/Named_Titles/Game.jpg", false},
+		{"Windows/Game.png", false},
+		{"../Named_Titles/Game.png", false},
+		{"Windows/../Game.png", false},
+		{"Windows/Named_Titles/Q*bert.png", false},
+		{`Windows/Named_Titles/a\b.png`, false},
+		{"C:/Named_Titles/Game.png", false},
+	}
+	for _, tt := range tests {
+		if got := ValidThumbnailPath(tt.path); got != tt.want {
+			t.Errorf("ValidThumbnailPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	existing := []Template{
+		NewRetroarch(),
+		{ID: "mine", ProcessName: "Game.exe", WindowTitle: "Game", System: "Windows", Game: "Game", Priority: 1},
+	}
+	pack := Pack{
+		Templates: []Template{
+			{ID: "theirs", ProcessName: "Game.exe", WindowTitle: "Game", System: "Windows", Game: "Game", Priority: 5,
+				NamedTitles: "Windows/Named_Titles/Game.png"},
+			{ID: "new", ProcessName: "New.exe", System: "Windows", Game: "New"},
+			{ID: "bad", ProcessName: `C:\Games\Bad.exe`},
+			{ID: "ra", ProcessName: "retroarch.exe", WindowTitle: "RetroArch"},
+		},
+		Images: map[string][]byte{"Windows/Named_Titles/Game.png": []byte("png")},
+	}
+
+	tests := []struct {
+		mode    string
+		actions []string
+		count   int
+		check   func(t *testing.T, list []Template, results []ImportResult)
+	}{
+		{
+			mode:    ConflictSkip,
+			actions: []string{ActionSkip, ActionAdd, ActionInvalid, ActionSkip},
+			count:   3,
+			check: func(t *testing.T, list []Template, results []ImportResult) {
+				if list[1].Priority != 1 {
+					t.Errorf("existing template changed: %+v", list[1])
+				}
+				if results[0].Images != nil {
+					t.Errorf("skipped template writes images: %v", results[0].Images)
+				}
+			},
+		},
+		{
+			mode:    ConflictOverwrite,
+			actions: []string{ActionOverwrite, ActionAdd, ActionInvalid, ActionSkip},
+			count:   3,
+			check: func(t *testing.T, list []Template, results []ImportResult) {
+				if list[1].ID != "mine" || list[1].Priority != 5 {
+					t.Errorf("overwritten template = %+v, want ID mine and priority 5", list[1])
+				}
+				if results[0].Images["Windows/Named_Titles/Game.png"] != "Windows/Named_Titles/Game.png" {
+					t.Errorf("images = %v", results[0].Images)
+				}
+			},
+		},
+		{
+			mode:    ConflictRename,
+			actions: []string{ActionRename, ActionAdd, ActionInvalid, ActionSkip},
+			count:   4,
+			check: func(t *testing.T, list []Template, results []ImportResult) {
+				renamed := list[Find(list, results[0].ID)]
+				if renamed.WindowTitle != "Game (2)" || results[0].RenamedTo != "Game (2)" {
+					t.Errorf("renamed template = %+v", renamed)
+				}
+				if renamed.NamedTitles != "Windows/Named_Titles/Game (2).png" {
+					t.Errorf("renamed thumbnail = %q", renamed.NamedTitles)
+				}
+				if results[0].Images["Windows/Named_Titles/Game (2).png"] != "Windows/Named_Titles/Game.png" {
+					t.Errorf("images = %v", results[0].Images)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			list, results, err := Import(existing, pack, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.actions) {
+				t.Fatalf("results = %+v", results)
+			}
+			for i, want := range tt.actions {
+				if results[i].Action != want {
+					t.Errorf("template %d: action %s, want %s", i, results[i].Action, want)
+				}
+			}
+			if len(list) != tt.count {
+				t.Errorf("got %d templates, want %d", len(list), tt.count)
+			}
+			for _, tmpl := range list {
+				if tmpl.ID == "theirs" || tmpl.ID == "new" {
+					t.Errorf("imported template kept the ID from the pack: %+v", tmpl)
+				}
+			}
+			if results[2].Errors["process_name"] == "" {
+				t.Errorf("invalid template has no error: %+v", results[2])
+			}
+			tt.check(t, list, results)
+		})
+	}
+	if existing[1].Priority != 1 {
+		t.Error("Import changed the list it was given")
+	}
+	if _, _, err := Import(existing, pack, "merge"); err == nil {
+		t.Error("unknown conflict mode accepted")
+	}
+}
@@ -0,0 +1,131 @@
+// Package templates describes which processes are games and stores them in
+// games.json.
+package templates
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// RetroarchID is the ID of the built-in RetroArch template that is added in
+// memory. It is never written to games.json.
+const RetroarchID = "retroarch"
+
+type Template struct {
+	ID           string `json:"id"`
+	ProcessName  string `json:"process_name"`
+	WindowTitle  string `json:"window_title"`
+	System       string `json:"system"`
+	Game         string `json:"game"`
+	NamedTitles  string `json:"named_titles"`
+	NamedBoxarts string `json:"named_boxarts"`
+	Priority     int    `json:"priority"`
+}
+
+// NewRetroarch returns the built-in template that tracks RetroArch.
+func NewRetroarch() Template {
+	return Template{
+		ID:          RetroarchID,
+		WindowTitle: "RetroArch",
+		ProcessName: "retroarch.exe",
+	}
+}
+
+// Key identifies a template by what it matches; two templates with the same
+// key are duplicates.
+func Key(tmpl Template) string {
+	return tmpl.ProcessName + "|" + tmpl.WindowTitle
+}
+
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("Error generating template id", "err", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// EnsureIDs gives every template without an ID a new one and reports
+// whether anything changed.
+func EnsureIDs(templates []Template) bool {
+	changed := false
+	for i := range templates {
+		if templates[i].ID == "" {
+			templates[i].ID = NewID()
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Validate fills defaults and checks tmpl against the other templates. It
+// returns an error message per invalid field.
+func Validate(tmpl *Template, others []Template) map[string]string {
+	fields := make(map[string]string)
+	tmpl.ProcessName = strings.TrimSpace(tmpl.ProcessName)
+	tmpl.WindowTitle = strings.TrimSpace(tmpl.WindowTitle)
+	if tmpl.ProcessName == "" {
+		fields["process_name"] = "required"
+	} else if strings.ContainsAny(tmpl.ProcessName, `\/`) {
+		fields["process_name"] = "must be a file name, not a path"
+	}
+	if tmpl.System == "" {
+		tmpl.System = "Windows"
+	}
+	if tmpl.Game == "" {
+		tmpl.Game = strings.TrimSuffix(tmpl.ProcessName, ".exe")
+	}
+	for _, other := range others {
+		if other.ID != tmpl.ID && Key(other) == Key(*tmpl) {
+			fields["process_name"] = fmt.Sprintf("template for %s with this window title already exists", tmpl.ProcessName)
+			break
+		}
+	}
+	return fields
+}
+
+// Find returns the index of the template with id, or -1.
+func Find(templates []Template, id string) int {
+	for i, tmpl := range templates {
+		if tmpl.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Remove drops the template with id, or every template of processName when
+// id is empty.
+func Remove(templates []Template, id, processName string) []Template {
+	filtered := []Template{}
+	for _, tmpl := range templates {
+		keep := tmpl.ProcessName != processName
+		if id != "" {
+			keep = tmpl.ID != id
+		}
+		if keep {
+			filtered = append(filtered, tmpl)
+		}
+	}
+	return filtered
+}
+
+func RemoveDuplicates(templates []Template) []Template {
+	// Последний шаблон с тем же ключом побеждает, но занимает место первого,
+	// чтобы порядок в games.json не менялся от сохранения к сохранению
+	index := make(map[string]int)
+	result := make([]Template, 0, len(templates))
+	for _, tmplt := range templates {
+		key := Key(tmplt)
+		if i, ok := index[key]; ok {
+			result[i] = tmplt
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, tmplt)
+	}
+	return result
+}
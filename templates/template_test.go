@@ -0,0 +1,65 @@
+package templates
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRemoveDuplicates(t *testing.T) {
+	a := Template{ID: "a", ProcessName: "a.exe", Game: "A"}
+	a2 := Template{ID: "a2", ProcessName: "a.exe", Game: "A again"}
+	aTitled := Template{ID: "at", ProcessName: "a.exe", WindowTitle: "Level editor"}
+	b := Template{ID: "b", ProcessName: "b.exe"}
+	tests := []struct {
+		name string
+		in   []Template
+		want []Template
+	}{
+		{"empty", nil, []Template{}},
+		{"no duplicates", []Template{a, aTitled, b}, []Template{a, aTitled, b}},
+		{"last one wins in the first place", []Template{a, b, a2}, []Template{a2, b}},
+		{"window title makes a different key", []Template{aTitled, a, a2}, []Template{aTitled, a2}},
+		{"built-in RetroArch is replaced too", []Template{NewRetroarch(), b, NewRetroarch()}, []Template{NewRetroarch(), b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := slices.Clone(tt.in)
+			got := RemoveDuplicates(in)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("RemoveDuplicates() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(in, tt.in) {
+				t.Error("RemoveDuplicates changed its input")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	others := []Template{{ID: "a", ProcessName: "Game.exe", WindowTitle: "Game"}}
+	tests := []struct {
+		name    string
+		tmpl    Template
+		invalid bool
+		want    Template
+	}{
+		{"defaults", Template{ID: "n", ProcessName: " Tool.exe "}, false, Template{ID: "n", ProcessName: "Tool.exe", System: "Windows", Game: "Tool"}},
+		{"required", Template{ID: "n"}, true, Template{}},
+		{"path", Template{ID: "n", ProcessName: `C:\Games\Game.exe`}, true, Template{}},
+		{"duplicate", Template{ID: "n", ProcessName: "Game.exe", WindowTitle: "Game "}, true, Template{}},
+		{"same template again", Template{ID: "a", ProcessName: "Game.exe", WindowTitle: "Game"}, false, Template{ID: "a", ProcessName: "Game.exe", WindowTitle: "Game", System: "Windows", Game: "Game"}},
+		{"other window title", Template{ID: "n", ProcessName: "Game.exe", WindowTitle: "Editor"}, false, Template{ID: "n", ProcessName: "Game.exe", WindowTitle: "Editor", System: "Windows", Game: "Game"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := tt.tmpl
+			fields := Validate(&tmpl, others)
+			if (len(fields) > 0) != tt.invalid {
+				t.Fatalf("Validate() = %v, want invalid %v", fields, tt.invalid)
+			}
+			if !tt.invalid && tmpl != tt.want {
+				t.Errorf("template = %+v, want %+v", tmpl, tt.want)
+			}
+		})
+	}
+}
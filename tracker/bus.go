@@ -0,0 +1,217 @@
+package tracker
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// queueSize is how many events a subscriber may fall behind before queued
+// events are dropped or merged to make room.
+const queueSize = 64
+
+// closeTimeout bounds how long Close waits for subscribers to catch up.
+const closeTimeout = 2 * time.Second
+
+// subscriber receives events on its own goroutine, in publish order.
+type subscriber struct {
+	name string
+	fn   func(Event)
+	wake chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	queue  []Event
+	closed bool
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+	for {
+		ev, ok := s.next()
+		if !ok {
+			return
+		}
+		s.fn(ev)
+	}
+}
+
+// next waits for the oldest queued event. It returns false once the
+// subscriber is stopped and everything queued was handled.
+func (s *subscriber) next() (Event, bool) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			ev := s.queue[0]
+			s.queue = slices.Delete(s.queue, 0, 1)
+			s.mu.Unlock()
+			return ev, true
+		}
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return Event{}, false
+		}
+		<-s.wake
+	}
+}
+
+// push queues ev without blocking. A full queue first loses a state event
+// that a newer one replaces: every event carries the whole state, so the
+// newest one is what matters. Settings and template changes are never lost,
+// only merged with a newer change of the same kind.
+func (s *subscriber) push(ev Event) {
+	s.mu.Lock()
+	if len(s.queue) >= queueSize {
+		ev = s.makeRoom(ev)
+	}
+	s.queue = append(s.queue, ev)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// stop lets run return after the queued events.
+func (s *subscriber) stop() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// makeRoom must be called with s.mu held. It removes one queued event before
+// ev is queued and returns ev, which may take over the Previous settings of a
+// merged ConfigChanged.
+func (s *subscriber) makeRoom(ev Event) Event {
+	// newer возвращает событие, пришедшее после i, которое заменяет его
+	newer := func(i int) *Event {
+		for j := i + 1; j < len(s.queue); j++ {
+			if replaces(s.queue[j], s.queue[i]) {
+				return &s.queue[j]
+			}
+		}
+		if replaces(ev, s.queue[i]) {
+			return &ev
+		}
+		return nil
+	}
+	for i, queued := range s.queue {
+		if isStateEvent(queued.Kind) && newer(i) != nil {
+			s.drop(i, "dropping event")
+			return ev
+		}
+	}
+	for i, queued := range s.queue {
+		if next := newer(i); next != nil {
+			if queued.Kind == ConfigChanged {
+				next.Previous = queued.Previous
+			}
+			s.drop(i, "merging event")
+			return ev
+		}
+	}
+	for i, queued := range s.queue {
+		if isStateEvent(queued.Kind) {
+			s.drop(i, "dropping event")
+			return ev
+		}
+	}
+	return ev
+}
+
+func (s *subscriber) drop(i int, what string) {
+	slog.Warn("Event subscriber is falling behind, "+what, "subscriber", s.name, "event", s.queue[i].Kind)
+	s.queue = slices.Delete(s.queue, i, i+1)
+}
+
+// isStateEvent reports whether events of kind only describe the state, so a
+// newer event of the same kind makes them obsolete.
+func isStateEvent(kind Kind) bool {
+	return kind != ConfigChanged && kind != TemplatesChanged
+}
+
+// replaces reports whether newer, published after older, carries everything
+// subscribers need from older: game events replace game events, slot events
+// replace those of the same slot, everything else replaces its own kind.
+func replaces(newer, older Event) bool {
+	isGame := func(kind Kind) bool { return kind == GameStarted || kind == GameChanged || kind == GameStopped }
+	switch {
+	case isGame(older.Kind):
+		return isGame(newer.Kind)
+	case older.Kind == SlotChanged:
+		return newer.Kind == SlotChanged && newer.Slot == older.Slot
+	default:
+		return newer.Kind == older.Kind
+	}
+}
+
+// bus delivers every published event to every subscriber. Publishing never
+// blocks, so a slow subscriber cannot hold up detection.
+type bus struct {
+	mu     sync.Mutex
+	subs   []*subscriber
+	closed bool
+}
+
+func (b *bus) subscribe(name string, fn func(Event)) {
+	s := &subscriber{
+		name: name,
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.subs = append(b.subs, s)
+	go s.run()
+}
+
+// publish queues ev for every subscriber. Events published one after another
+// reach each subscriber in that order.
+func (b *bus) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	slog.Debug("Publishing event", "event", ev.Kind)
+	for _, s := range b.subs {
+		s.push(ev)
+	}
+}
+
+// close stops accepting events and waits, up to closeTimeout, for subscribers
+// to handle the ones already queued.
+func (b *bus) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	subs := b.subs
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.stop()
+	}
+	timeout := time.After(closeTimeout)
+	for _, s := range subs {
+		select {
+		case <-s.done:
+		case <-timeout:
+			slog.Warn("Event subscriber did not finish in time", "subscriber", s.name)
+			return
+		}
+	}
+}
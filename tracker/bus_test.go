@@ -0,0 +1,144 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/config"
+)
+
+func newTestSubscriber() *subscriber {
+	return &subscriber{name: "test", wake: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+func TestSubscriberFullQueue(t *testing.T) {
+	configEvent := func(from, to int) Event {
+		return Event{Kind: ConfigChanged, Previous: config.Config{WebPort: from}, Config: config.Config{WebPort: to}}
+	}
+	gameEvent := func(i int) Event {
+		return Event{Kind: GameChanged, State: State{Game: fmt.Sprint("game ", i)}}
+	}
+	tests := []struct {
+		name   string
+		events []Event
+		check  func(t *testing.T, queue []Event)
+	}{
+		{
+			name: "config change survives a flood of game events",
+			events: func() []Event {
+				events := []Event{configEvent(1, 2)}
+				for i := range 2 * queueSize {
+					events = append(events, gameEvent(i))
+				}
+				return events
+			}(),
+			check: func(t *testing.T, queue []Event) {
+				if queue[0].Kind != ConfigChanged || queue[0].Previous.WebPort != 1 {
+					t.Errorf("first event = %+v, want the config change", queue[0])
+				}
+				last := queue[len(queue)-1]
+				if last.State.Game != fmt.Sprint("game ", 2*queueSize-1) {
+					t.Errorf("last event = %+v, want the newest game", last)
+				}
+			},
+		},
+		{
+			name: "config changes are merged, keeping the first previous settings",
+			events: func() []Event {
+				var events []Event
+				for i := range 2 * queueSize {
+					events = append(events, configEvent(i, i+1), Event{Kind: TemplatesChanged})
+				}
+				return events
+			}(),
+			check: func(t *testing.T, queue []Event) {
+				configs, templates := 0, 0
+				for _, ev := range queue {
+					switch ev.Kind {
+					case ConfigChanged:
+						configs++
+					case TemplatesChanged:
+						templates++
+					}
+				}
+				if configs == 0 || templates == 0 {
+					t.Fatalf("queue lost a kind: %d config, %d templates events", configs, templates)
+				}
+				var first Event
+				for _, ev := range queue {
+					if ev.Kind == ConfigChanged {
+						first = ev
+						break
+					}
+				}
+				if first.Previous.WebPort != 0 {
+					t.Errorf("merged config change starts at %d, want 0", first.Previous.WebPort)
+				}
+				if last := queue[len(queue)-2]; last.Config.WebPort != 2*queueSize {
+					t.Errorf("newest config change = %+v", last)
+				}
+			},
+		},
+		{
+			name: "slot events only replace the same slot",
+			events: func() []Event {
+				events := []Event{{Kind: SlotChanged, Slot: "left"}}
+				for i := range 2 * queueSize {
+					events = append(events, Event{Kind: SlotChanged, Slot: "right", State: State{Game: fmt.Sprint(i)}})
+				}
+				return events
+			}(),
+			check: func(t *testing.T, queue []Event) {
+				if queue[0].Slot != "left" {
+					t.Errorf("first event = %+v, want the left slot", queue[0])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSubscriber()
+			for _, ev := range tt.events {
+				s.push(ev)
+			}
+			if len(s.queue) > queueSize {
+				t.Fatalf("queue grew to %d events", len(s.queue))
+			}
+			tt.check(t, s.queue)
+		})
+	}
+}
+
+func TestSubscriberOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []int
+	var b bus
+	b.subscribe("test", func(ev Event) {
+		mu.Lock()
+		got = append(got, ev.Previous.WebPort)
+		mu.Unlock()
+	})
+	for i := range 10 {
+		b.publish(Event{Kind: ConfigChanged, Previous: config.Config{WebPort: i}})
+	}
+	done := make(chan struct{})
+	go func() {
+		b.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close did not return")
+	}
+	for i, port := range got {
+		if port != i {
+			t.Fatalf("events out of order: %v", got)
+		}
+	}
+	if len(got) != 10 {
+		t.Errorf("got %d events, want 10", len(got))
+	}
+}
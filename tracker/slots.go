@@ -0,0 +1,79 @@
+package tracker
+
+import (
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// MaxSlots limits how many named slots can exist at once.
+const MaxSlots = 16
+
+var slotNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// ValidSlotName reports whether name can name a slot, e.g. "player2" or
+// "pc-b". The empty name is the default slot and is not valid here.
+func ValidSlotName(name string) bool {
+	return slotNamePattern.MatchString(name)
+}
+
+// SlotState returns the state of the named slot, or of the default slot for
+// "". A slot nobody has filled yet is empty, so widgets for it can be set up
+// before its source is online.
+func (t *Tracker) SlotState(name string) State {
+	snap := t.Snapshot()
+	if name == "" {
+		return snap.State
+	}
+	return snap.Slots[name]
+}
+
+// Slots returns the names of the named slots in order.
+func (t *Tracker) Slots() []string {
+	return slices.Sorted(maps.Keys(t.Snapshot().Slots))
+}
+
+// SetSlot makes state the state of the named slot and publishes SlotChanged
+// if it differs. It returns false when name is new and MaxSlots are in use.
+func (t *Tracker) SetSlot(name string, state State) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slots := t.Snapshot().Slots
+	previous, ok := slots[name]
+	if ok && previous == state {
+		return true
+	}
+	if !ok && len(slots) >= MaxSlots {
+		return false
+	}
+	if previous.Game != state.Game || previous.System != state.System {
+		slog.Info("Updated info", "slot", name, "game", state.Game, "system", state.System, "agent", state.Agent)
+	}
+	ev := &Event{Kind: SlotChanged, Slot: name, PreviousState: previous}
+	t.change(ev, func(next *Snapshot) {
+		next.Slots = maps.Clone(next.Slots)
+		if next.Slots == nil {
+			next.Slots = make(map[string]State)
+		}
+		next.Slots[name] = state
+	})
+	return true
+}
+
+// ClearSlot removes the named slot and publishes SlotChanged with an empty
+// state, so its widgets go blank.
+func (t *Tracker) ClearSlot(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous, ok := t.Snapshot().Slots[name]
+	if !ok {
+		return
+	}
+	slog.Info("Slot removed", "slot", name)
+	ev := &Event{Kind: SlotChanged, Slot: name, PreviousState: previous}
+	t.change(ev, func(next *Snapshot) {
+		next.Slots = maps.Clone(next.Slots)
+		delete(next.Slots, name)
+	})
+}
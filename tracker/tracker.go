@@ -0,0 +1,426 @@
+// Package tracker holds what TrackGameName currently knows: the settings, the
+// game templates and the game being played. Everything else reads it from a
+// Tracker and subscribes to its change events.
+package tracker
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/templates"
+)
+
+// Kind says what changed.
+type Kind int
+
+const (
+	// GameStarted: a game is detected after none was.
+	GameStarted Kind = iota
+	// GameChanged: a different game or system is detected.
+	GameChanged
+	// GameStopped: the game is gone, e.g. RetroArch was closed.
+	GameStopped
+	RetroarchChanged
+	ConfigChanged
+	TemplatesChanged
+	// AgentChanged: a remote agent connected or went offline. It comes after
+	// the game events of the same switch.
+	AgentChanged
+	// SlotChanged: the state of the named slot Event.Slot changed or the slot
+	// was removed. The game events above are about the default slot only.
+	SlotChanged
+)
+
+func (k Kind) String() string {
+	switch k {
+	case GameStarted:
+		return "game_started"
+	case GameChanged:
+		return "game_changed"
+	case GameStopped:
+		return "game_stopped"
+	case RetroarchChanged:
+		return "retroarch_changed"
+	case ConfigChanged:
+		return "config_changed"
+	case TemplatesChanged:
+		return "templates_changed"
+	case AgentChanged:
+		return "agent_changed"
+	case SlotChanged:
+		return "slot_changed"
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// State is the game shown right now.
+type State struct {
+	Game             string
+	System           string
+	RetroarchRunning bool
+	// Agent names the remote agent the state comes from; it is empty while
+	// this computer's own detection is shown.
+	Agent string
+}
+
+// Event is passed to subscribers after a change. It carries the whole state
+// and settings at that moment, so a subscriber never has to ask the Tracker.
+// Previous is only set for ConfigChanged, PreviousState for game events.
+// For SlotChanged, Slot names the slot and State and PreviousState are its own.
+type Event struct {
+	Kind          Kind
+	State         State
+	Config        config.Config
+	Previous      config.Config
+	PreviousState State
+	Slot          string
+}
+
+// FileError describes a data file that could not be loaded or migrated.
+type FileError struct {
+	File string
+	Err  string
+}
+
+// Snapshot is everything the Tracker knows at one moment. A snapshot is never
+// modified once published: changes build a new one, so readers may keep and
+// use it without locking. Its slices and maps must not be modified.
+type Snapshot struct {
+	// State is the default slot: this computer's detection or the agent that
+	// replaces it.
+	State State
+	// Slots are the named slots pushed by agents and the API.
+	Slots      map[string]State
+	Config     config.Config
+	Templates  []templates.Template
+	FileErrors []FileError
+}
+
+// Tracker is the single owner of the state shared by detection, outputs, the
+// web server and the tray. Changes go through its methods one at a time;
+// readers get immutable snapshots. It is safe for concurrent use.
+type Tracker struct {
+	// mu serializes changes; readers never take it.
+	mu          sync.Mutex
+	current     atomic.Pointer[Snapshot]
+	fs          fsutil.FS
+	savePath    string
+	gamesLocked bool
+	// local is what this computer's detection sees. It is shown unless an
+	// agent sent remote.
+	local  State
+	remote *State
+
+	events bus
+}
+
+// New returns a tracker for cfg. savePath is the folder of games.json and the
+// default folder of the output files; games.json is read and written via fsys.
+func New(cfg config.Config, savePath string, fsys fsutil.FS) *Tracker {
+	t := &Tracker{fs: fsys, savePath: savePath}
+	t.current.Store(&Snapshot{
+		Config:    cfg,
+		Templates: []templates.Template{templates.NewRetroarch()},
+	})
+	return t
+}
+
+// Subscribe calls fn for every event from now on. Each subscriber runs on its
+// own goroutine and sees events in the order they happened; name shows up in
+// the log if it falls behind.
+func (t *Tracker) Subscribe(name string, fn func(Event)) {
+	t.events.subscribe(name, fn)
+}
+
+// Close delivers the events already queued and stops the subscribers.
+func (t *Tracker) Close() {
+	t.events.close()
+}
+
+// Snapshot returns the current state, settings, templates and file errors.
+func (t *Tracker) Snapshot() *Snapshot {
+	return t.current.Load()
+}
+
+// change must be called with t.mu held. It lets fn edit a copy of the current
+// snapshot, swaps the copy in and, unless ev is nil, publishes ev with the new
+// state. Events are queued in the same order as the changes they describe.
+func (t *Tracker) change(ev *Event, fn func(next *Snapshot)) {
+	next := *t.current.Load()
+	fn(&next)
+	t.current.Store(&next)
+	if ev != nil {
+		ev.State, ev.Config = next.State, next.Config
+		if ev.Kind == SlotChanged {
+			ev.State = next.Slots[ev.Slot]
+		}
+		t.events.publish(*ev)
+	}
+}
+
+// Config returns the current settings.
+func (t *Tracker) Config() config.Config {
+	return t.Snapshot().Config
+}
+
+// SetConfig replaces the settings and publishes ConfigChanged.
+func (t *Tracker) SetConfig(cfg config.Config) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ev := &Event{Kind: ConfigChanged, Previous: t.Config()}
+	t.change(ev, func(next *Snapshot) { next.Config = cfg })
+}
+
+// FS returns the filesystem the tracker was created with.
+func (t *Tracker) FS() fsutil.FS {
+	return t.fs
+}
+
+// SavePath returns the folder chosen at startup for games.json.
+func (t *Tracker) SavePath() string {
+	return t.savePath
+}
+
+// OutputDir returns the folder for game.txt, console.txt and output.txt.
+func (t *Tracker) OutputDir() string {
+	if dir := t.Config().SavePath; dir != "" {
+		return dir
+	}
+	return t.savePath
+}
+
+// State returns what is being played right now.
+func (t *Tracker) State() State {
+	return t.Snapshot().State
+}
+
+// LocalState returns what this computer's detection sees, even while the
+// state of a remote agent is shown.
+func (t *Tracker) LocalState() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.local
+}
+
+// SetGame makes game on system the current game. It publishes GameStarted or
+// GameChanged and returns true if either differs from before.
+func (t *Tracker) SetGame(system, game string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.local.Game == game && t.local.System == system {
+		return false
+	}
+	slog.Info("Updated info", "game", game, "system", system)
+	t.local.Game, t.local.System = game, system
+	if t.remote == nil {
+		t.show(t.local)
+	}
+	return true
+}
+
+// ClearGame forgets the current game and publishes GameStopped.
+func (t *Tracker) ClearGame() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.local.Game, t.local.System = "", ""
+	if t.remote != nil {
+		return
+	}
+	// публикуем даже без изменений: при запуске это очищает выходные файлы
+	ev := &Event{Kind: GameStopped, PreviousState: t.State()}
+	t.change(ev, func(next *Snapshot) { next.State.Game, next.State.System = "", "" })
+}
+
+// SetRetroarchRunning records whether RetroArch is open and publishes
+// RetroarchChanged when that changes.
+func (t *Tracker) SetRetroarchRunning(running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.local.RetroarchRunning = running
+	if t.remote == nil {
+		t.show(t.local)
+	}
+}
+
+// SetRemote shows the state sent by a remote agent instead of this
+// computer's detection. state.Agent must name the agent.
+func (t *Tracker) SetRemote(state State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.remote == nil || t.remote.Game != state.Game || t.remote.System != state.System {
+		slog.Info("Updated info from agent", "agent", state.Agent, "game", state.Game, "system", state.System)
+	}
+	t.remote = &state
+	t.show(state)
+}
+
+// ClearRemote goes back to this computer's detection after the agent went
+// offline.
+func (t *Tracker) ClearRemote() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.remote == nil {
+		return
+	}
+	slog.Info("Agent offline, using own detection", "agent", t.remote.Agent)
+	t.remote = nil
+	t.show(t.local)
+}
+
+// show must be called with t.mu held. It makes next the shown state and
+// publishes an event for every part of it that changed. Game events already
+// carry the new agent, AgentChanged comes last.
+func (t *Tracker) show(next State) {
+	previous := t.State()
+	if previous.Game != next.Game || previous.System != next.System {
+		ev := &Event{Kind: GameChanged, PreviousState: previous}
+		switch {
+		case next.Game == "":
+			ev.Kind = GameStopped
+		case previous.Game == "":
+			ev.Kind = GameStarted
+		}
+		// источник меняется вместе с игрой, чтобы событие игры его уже знало
+		t.change(ev, func(s *Snapshot) {
+			s.State.Game, s.State.System, s.State.Agent = next.Game, next.System, next.Agent
+		})
+	}
+	if previous.RetroarchRunning != next.RetroarchRunning {
+		ev := &Event{Kind: RetroarchChanged, PreviousState: t.State()}
+		t.change(ev, func(s *Snapshot) { s.State.RetroarchRunning = next.RetroarchRunning })
+	}
+	if previous.Agent != next.Agent {
+		ev := &Event{Kind: AgentChanged, PreviousState: previous}
+		t.change(ev, func(s *Snapshot) { s.State.Agent = next.Agent })
+	}
+}
+
+// Templates returns a copy of the game templates, including the built-in
+// RetroArch one.
+func (t *Tracker) Templates() []templates.Template {
+	return append([]templates.Template(nil), t.Snapshot().Templates...)
+}
+
+func (t *Tracker) gamesPath() string {
+	return filepath.Join(t.savePath, "games.json")
+}
+
+// LoadTemplates reads games.json at startup. If it cannot be read the file is
+// recorded as broken and saving templates is refused until it loads again.
+func (t *Tracker) LoadTemplates() error {
+	path := t.gamesPath()
+	loaded, err := templates.Load(t.fs, path)
+	if err != nil {
+		slog.Error("Error loading file", "file", path, "err", err)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.gamesLocked = true
+		t.change(nil, func(next *Snapshot) {
+			next.Templates = []templates.Template{templates.NewRetroarch()}
+			next.FileErrors = withFileError(next.FileErrors, path, err)
+		})
+		return fmt.Errorf("error loading games.json: %v", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.change(&Event{Kind: TemplatesChanged}, func(next *Snapshot) {
+		next.Templates = templates.RemoveDuplicates(append(loaded, templates.NewRetroarch()))
+	})
+	return nil
+}
+
+// ReloadTemplates replaces the templates with the contents of games.json
+// after it was edited by hand. A file that holds the templates already loaded,
+// such as one just written by UpdateTemplates, changes nothing.
+func (t *Tracker) ReloadTemplates() error {
+	path := t.gamesPath()
+	loaded, err := templates.Read(t.fs, path)
+	if err != nil {
+		return err
+	}
+	loaded = templates.RemoveDuplicates(append(loaded, templates.NewRetroarch()))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.gamesLocked && sameTemplates(loaded, t.Snapshot().Templates) {
+		slog.Debug("games.json holds the current templates, nothing to reload")
+		return nil
+	}
+	t.gamesLocked = false
+	t.change(&Event{Kind: TemplatesChanged}, func(next *Snapshot) {
+		next.Templates = loaded
+		next.FileErrors = withoutFileErrors(next.FileErrors, path)
+	})
+	slog.Info("Reloaded game templates from games.json")
+	return nil
+}
+
+// sameTemplates reports whether a and b hold the same templates in the same
+// order. The built-in RetroArch template may sit anywhere in either list.
+func sameTemplates(a, b []templates.Template) bool {
+	isRetroarch := func(tmpl templates.Template) bool { return tmpl.ID == templates.RetroarchID }
+	a = slices.DeleteFunc(slices.Clone(a), isRetroarch)
+	b = slices.DeleteFunc(slices.Clone(b), isRetroarch)
+	return slices.Equal(a, b)
+}
+
+// UpdateTemplates lets fn edit a copy of the templates, saves the result to
+// games.json and publishes TemplatesChanged. Nothing changes if fn or saving
+// fails.
+func (t *Tracker) UpdateTemplates(fn func([]templates.Template) ([]templates.Template, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gamesLocked {
+		return fmt.Errorf("games.json could not be loaded, refusing to overwrite it")
+	}
+	updated, err := fn(t.Templates())
+	if err != nil {
+		return err
+	}
+	updated = templates.RemoveDuplicates(updated)
+	if err := templates.Save(t.fs, t.gamesPath(), updated); err != nil {
+		return err
+	}
+	t.change(&Event{Kind: TemplatesChanged}, func(next *Snapshot) { next.Templates = updated })
+	return nil
+}
+
+// FileErrors returns the data files that failed to load.
+func (t *Tracker) FileErrors() []FileError {
+	return append([]FileError(nil), t.Snapshot().FileErrors...)
+}
+
+func (t *Tracker) AddFileError(file string, err error) {
+	slog.Error("Error loading file", "file", file, "err", err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.change(nil, func(next *Snapshot) { next.FileErrors = withFileError(next.FileErrors, file, err) })
+}
+
+// ClearFileErrors forgets errors for file after it loaded successfully.
+func (t *Tracker) ClearFileErrors(file string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.change(nil, func(next *Snapshot) { next.FileErrors = withoutFileErrors(next.FileErrors, file) })
+}
+
+// withFileError and withoutFileErrors return new slices; the old one may still
+// be in use by a reader.
+func withFileError(list []FileError, file string, err error) []FileError {
+	return append(append([]FileError(nil), list...), FileError{File: file, Err: err.Error()})
+}
+
+func withoutFileErrors(list []FileError, file string) []FileError {
+	var kept []FileError
+	for _, fe := range list {
+		if fe.File != file {
+			kept = append(kept, fe)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,145 @@
+package tracker
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/templates"
+)
+
+func TestReloadTemplates(t *testing.T) {
+	fsys := fsutil.NewMemFS()
+	path := filepath.Join("save", "games.json")
+	// шаблоны, дописанные вручную, приходят без ID
+	handEdited := `{"version": 2, "templates": [{"process_name": "Game.exe", "game": "Game"}]}`
+	if err := fsys.WriteFile(path, []byte(handEdited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tr := New(config.Config{}, "save", fsys)
+	defer tr.Close()
+
+	if err := tr.ReloadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	list := tr.Templates()
+	i := templates.Find(list, "")
+	if i >= 0 {
+		t.Fatalf("template without ID after reload: %+v", list[i])
+	}
+	id := list[0].ID
+
+	// файл с новыми ID уже сохранён, повторная загрузка ничего не меняет
+	before := tr.Snapshot()
+	if err := tr.ReloadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Snapshot() != before {
+		t.Error("reloading an unchanged games.json published a new snapshot")
+	}
+	if got := tr.Templates()[0].ID; got != id {
+		t.Errorf("template ID changed on reload: %s, was %s", got, id)
+	}
+
+	// то же после записи самой программой
+	err := tr.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		list[0].Game = "Renamed"
+		return list, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before = tr.Snapshot()
+	if err := tr.ReloadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Snapshot() != before {
+		t.Error("reloading games.json written by UpdateTemplates published a new snapshot")
+	}
+}
+
+// TestConcurrentChanges changes the tracker from several goroutines while
+// others read it, as detection, the web server and the agent client do. It
+// finds most with go test -race.
+func TestConcurrentChanges(t *testing.T) {
+	const rounds = 200
+	tr := New(config.Config{LogLevel: "info", ThumbnailSwitchInterval: 5}, "save", fsutil.NewMemFS())
+	var mu sync.Mutex
+	var last State
+	tr.Subscribe("test", func(ev Event) {
+		if ev.Kind == SlotChanged {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		last = ev.State
+	})
+
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				fn(i)
+			}
+		}()
+	}
+	run(func(i int) {
+		if i%3 == 0 {
+			tr.ClearGame()
+		} else {
+			tr.SetGame("Windows", fmt.Sprintf("Game %d", i))
+		}
+	})
+	run(func(i int) { tr.SetRetroarchRunning(i%2 == 0) })
+	run(func(i int) {
+		if i%2 == 0 {
+			tr.SetRemote(State{Agent: "pc", Game: "Remote", System: "Windows"})
+		} else {
+			tr.ClearRemote()
+		}
+	})
+	run(func(i int) { tr.SetSlot("left", State{Game: fmt.Sprintf("Slot %d", i)}) })
+	run(func(i int) {
+		// log_level и интервал меняются только вместе
+		cfg := tr.Config()
+		cfg.LogLevel, cfg.ThumbnailSwitchInterval = "info", 5
+		if i%2 == 0 {
+			cfg.LogLevel, cfg.ThumbnailSwitchInterval = "debug", 7
+		}
+		tr.SetConfig(cfg)
+	})
+	run(func(i int) {
+		err := tr.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			return append(list, templates.Template{ID: templates.NewID(), ProcessName: fmt.Sprintf("Game%d.exe", i)}), nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	run(func(int) {
+		snap := tr.Snapshot()
+		if (snap.Config.LogLevel == "debug") != (snap.Config.ThumbnailSwitchInterval == 7) {
+			t.Errorf("snapshot mixes two settings: %+v", snap.Config)
+		}
+		_ = tr.State()
+		_ = tr.Templates()
+	})
+	wg.Wait()
+	tr.ClearRemote()
+	tr.SetGame("Windows", "Final")
+	tr.Close()
+
+	if got := len(tr.Templates()); got != rounds+1 {
+		t.Errorf("%d templates, want %d", got, rounds+1)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last != tr.State() {
+		t.Errorf("last event has state %+v, tracker has %+v", last, tr.State())
+	}
+}
@@ -0,0 +1,144 @@
+// Package tray shows the tray icon with the current game and a menu for
+// opening the web pages, switching profiles and quitting.
+package tray
+
+import (
+	_ "embed"
+	"log/slog"
+	"os/exec"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/getlantern/systray"
+)
+
+//go:embed active.ico
+var activeIcon []byte
+
+//go:embed inactive.ico
+var inactiveIcon []byte
+
+// Options configure the tray icon and its menu.
+type Options struct {
+	Tracker       *tracker.Tracker
+	T             i18n.Translations
+	Profiles      []string
+	ActiveProfile string
+	// SwitchProfile makes another profile active.
+	SwitchProfile func(name string) error
+}
+
+// Run shows the tray icon and blocks until Quit is called. onExit runs before
+// Run returns.
+func Run(opts Options, onExit func()) {
+	systray.Run(func() { onReady(opts) }, onExit)
+}
+
+// Quit closes the tray and makes Run return.
+func Quit() {
+	systray.Quit()
+}
+
+func onReady(opts Options) {
+	t := opts.T
+	systray.SetTitle(t["title"])
+	systray.SetTooltip(t["title"])
+	slog.Debug("Systray initialized")
+
+	gameItem := systray.AddMenuItem(t["game_not_detected"], t["game_not_detected"])
+	consoleItem := systray.AddMenuItem(t["system_not_detected"], t["system_not_detected"])
+	systray.AddSeparator()
+	openWebItem := systray.AddMenuItem(t["open_web_page"], t["open_web_page_tip"])
+	openSettingsItem := systray.AddMenuItem(t["open_settings"], t["open_settings_tip"])
+	addProfileMenu(opts)
+	quitItem := systray.AddMenuItem(t["exit"], t["exit_tip"])
+	slog.Debug("Menu items added")
+
+	show := func(state tracker.State) {
+		if state.Game != "" {
+			gameItem.SetTitle("Game: " + state.Game)
+			consoleItem.SetTitle("System: " + state.System)
+		} else {
+			gameItem.SetTitle(t["game_not_detected"])
+			consoleItem.SetTitle(t["system_not_detected"])
+		}
+		if state.RetroarchRunning || state.Game != "" {
+			systray.SetIcon(activeIcon)
+		} else {
+			systray.SetIcon(inactiveIcon)
+		}
+	}
+	show(opts.Tracker.State())
+	opts.Tracker.Subscribe("tray", func(ev tracker.Event) {
+		switch ev.Kind {
+		case tracker.GameStarted, tracker.GameChanged, tracker.GameStopped, tracker.RetroarchChanged:
+			show(ev.State)
+		}
+	})
+
+	go func() {
+		for {
+			select {
+			case <-openWebItem.ClickedCh:
+				url := config.LocalURL(opts.Tracker.Config()) + "/"
+				err := openBrowser(url)
+				if err != nil {
+					slog.Error("Error opening browser", "err", err)
+				} else {
+					slog.Debug("Main page opened in browser")
+				}
+			case <-openSettingsItem.ClickedCh:
+				url := config.LocalURL(opts.Tracker.Config()) + "/settings"
+				err := openBrowser(url)
+				if err != nil {
+					slog.Error("Error opening settings page", "err", err)
+				} else {
+					slog.Debug("Settings page opened in browser")
+				}
+			case <-quitItem.ClickedCh:
+				slog.Info("Exit clicked")
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+// addProfileMenu adds the submenu that switches between profiles. It is only
+// shown when the profiles folder has at least one profile.
+func addProfileMenu(opts Options) {
+	profiles := opts.Profiles
+	if len(profiles) < 2 {
+		return
+	}
+	t := opts.T
+	menu := systray.AddMenuItem(t["profile"]+": "+opts.ActiveProfile, t["profile_tip"])
+	items := make([]*systray.MenuItem, len(profiles))
+	for i, name := range profiles {
+		items[i] = menu.AddSubMenuItemCheckbox(name, name, name == opts.ActiveProfile)
+	}
+	for i, name := range profiles {
+		go func(item *systray.MenuItem, name string) {
+			for range item.ClickedCh {
+				if err := opts.SwitchProfile(name); err != nil {
+					slog.Error("Error switching profile", "profile", name, "err", err)
+					continue
+				}
+				for j, other := range items {
+					if profiles[j] == name {
+						other.Check()
+					} else {
+						other.Uncheck()
+					}
+				}
+				menu.SetTitle(t["profile"] + ": " + name)
+			}
+		}(items[i], name)
+	}
+}
+
+func openBrowser(url string) error {
+	return exec.Command("cmd", "/c", "start", url).Start()
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"WatchdogRetroArch/agent"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/gorilla/websocket"
+)
+
+// agentUpgrader accepts agents, which are programs and send no Origin.
+var agentUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "" },
+}
+
+// agentThumbnailsDir keeps the thumbnails agents sent, laid out like
+// thumbnails_path.
+func (s *Server) agentThumbnailsDir() string {
+	return filepath.Join(s.dirs.Save, "agent", "thumbnails")
+}
+
+// handleAgent receives the state of a remote agent. Without ?slot= it is
+// shown instead of this computer's detection until the agent goes offline;
+// with it the agent fills that named slot. Each slot shows one agent at a
+// time, a new connection replaces the old one.
+func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	token := s.tracker.Config().AgentToken
+	if token == "" {
+		writeAPIError(w, http.StatusNotFound, "agent connections are off, set agent_token", nil)
+		return
+	}
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !equalSecret(bearer, token) {
+		slog.Warn("Rejected agent with wrong agent_token", "remote", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="TrackGameName agent"`)
+		writeAPIError(w, http.StatusUnauthorized, "agent token required", nil)
+		return
+	}
+	slot := r.URL.Query().Get("slot")
+	if slot != "" && !tracker.ValidSlotName(slot) {
+		writeAPIError(w, http.StatusBadRequest, "invalid slot name", nil)
+		return
+	}
+	conn, err := agentUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("Error upgrading agent connection", "err", err)
+		return
+	}
+	conn.SetReadLimit(maxMessageSize)
+
+	s.agentMu.Lock()
+	if old := s.agentConns[slot]; old != nil {
+		slog.Info("Another agent connected, closing the previous one", "slot", slot)
+		old.Close()
+	}
+	s.agentConns[slot] = conn
+	s.agentMu.Unlock()
+	defer func() {
+		conn.Close()
+		s.agentMu.Lock()
+		if s.agentConns[slot] == conn {
+			delete(s.agentConns, slot)
+			if slot == "" {
+				s.tracker.ClearRemote()
+			} else {
+				s.tracker.ClearSlot(slot)
+			}
+		}
+		s.agentMu.Unlock()
+	}()
+
+	name := r.RemoteAddr
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(agent.Timeout)); err != nil {
+			return
+		}
+		var msg agent.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			slog.Warn("Agent disconnected", "agent", name, "err", err)
+			return
+		}
+		switch msg.Type {
+		case agent.TypeHello:
+			if n := agentName(msg.Name); n != "" {
+				name = n
+			}
+			slog.Info("Agent connected", "agent", name, "slot", slot, "remote", r.RemoteAddr, "version", msg.Version)
+		case agent.TypeThumbnail:
+			if err := s.saveAgentThumbnail(msg.Path, msg.Data); err != nil {
+				slog.Warn("Rejected thumbnail from agent", "agent", name, "path", msg.Path, "err", err)
+			}
+		case agent.TypeState:
+			if msg.State == nil {
+				continue
+			}
+			state := tracker.State{
+				Game:             msg.State.Game,
+				System:           msg.State.System,
+				RetroarchRunning: msg.State.RetroarchRunning,
+				Agent:            name,
+			}
+			if slot == "" {
+				s.tracker.SetRemote(state)
+			} else if !s.tracker.SetSlot(slot, state) {
+				slog.Warn("Too many slots, dropping agent", "agent", name, "slot", slot, "max", tracker.MaxSlots)
+				return
+			}
+		case agent.TypePing:
+		default:
+			slog.Debug("Unknown agent message", "type", msg.Type)
+		}
+	}
+}
+
+// agentName keeps the name an agent reports short and printable.
+func agentName(name string) string {
+	name = strings.TrimSpace(strings.ToValidUTF8(name, ""))
+	if utf8.RuneCountInString(name) > 64 {
+		name = string([]rune(name)[:64])
+	}
+	return name
+}
+
+// saveAgentThumbnail checks a thumbnail like an upload and stores it at the
+// same place under agentThumbnailsDir as it has under the agent's
+// thumbnails_path.
+func (s *Server) saveAgentThumbnail(rel string, data []byte) error {
+	parts := strings.Split(rel, "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".png") {
+		return fmt.Errorf("unexpected thumbnail path %q", rel)
+	}
+	decoded, err := decodeThumbnail(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_, err = writeThumbnail(s.agentThumbnailsDir(), parts[0], strings.ToLower(parts[1]), strings.TrimSuffix(parts[2], ".png"), decoded)
+	return err
+}
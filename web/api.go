@@ -0,0 +1,333 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+// apiError is the body of every non-2xx response from /api/v1.
+type apiError struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// StatusResponse is returned by /api/v1/status.
+type StatusResponse struct {
+	Version          string `json:"version"`
+	RetroarchRunning bool   `json:"retroarch_running"`
+	Game             string `json:"game"`
+	Console          string `json:"console"`
+	// Agent names the remote agent whose game is shown, if any.
+	Agent string `json:"agent,omitempty"`
+}
+
+// SlotResponse is one entry of /api/v1/slots.
+type SlotResponse struct {
+	Slot             string `json:"slot"`
+	RetroarchRunning bool   `json:"retroarch_running"`
+	Game             string `json:"game"`
+	Console          string `json:"console"`
+	Agent            string `json:"agent,omitempty"`
+}
+
+// slotRequest is the body of PUT /api/v1/slots/{name}.
+type slotRequest struct {
+	Game             string `json:"game"`
+	Console          string `json:"console"`
+	RetroarchRunning bool   `json:"retroarch_running"`
+}
+
+// importResponse is returned by POST /api/v1/templates/import.
+type importResponse struct {
+	DryRun   bool                     `json:"dry_run"`
+	Conflict string                   `json:"conflict"`
+	Results  []templates.ImportResult `json:"results"`
+}
+
+// templatePatch mirrors templates.Template with optional fields for PATCH requests.
+type templatePatch struct {
+	ProcessName  *string `json:"process_name"`
+	WindowTitle  *string `json:"window_title"`
+	System       *string `json:"system"`
+	Game         *string `json:"game"`
+	NamedTitles  *string `json:"named_titles"`
+	NamedBoxarts *string `json:"named_boxarts"`
+	Priority     *int    `json:"priority"`
+}
+
+var (
+	errTemplateNotFound = errors.New("template not found")
+	errBuiltinTemplate  = errors.New("the built-in RetroArch template cannot be changed")
+)
+
+// validationError carries the per-field messages of templates.Validate.
+type validationError map[string]string
+
+func (e validationError) Error() string {
+	return "validation failed"
+}
+
+// describe lists the messages as "field: message" for the log and pages
+// that show a single line.
+func (e validationError) describe() string {
+	keys := slices.Sorted(maps.Keys(e))
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + ": " + e[key]
+	}
+	return strings.Join(parts, "; ")
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string, fields map[string]string) {
+	writeJSON(w, status, apiError{Error: msg, Fields: fields})
+}
+
+// writeTemplateError maps an error from a template change to a response.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	var fields validationError
+	switch {
+	case errors.As(err, &fields):
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error(), fields)
+	case errors.Is(err, errTemplateNotFound):
+		writeAPIError(w, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, errBuiltinTemplate):
+		writeAPIError(w, http.StatusConflict, err.Error(), nil)
+	default:
+		slog.Error("Error saving game templates", "err", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to save templates", nil)
+	}
+}
+
+// editTemplate finds the template with id, lets edit change it and stores the
+// validated result.
+func (s *Server) editTemplate(id string, edit func(*templates.Template)) (templates.Template, error) {
+	var tmpl templates.Template
+	err := s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		i := templates.Find(list, id)
+		if i < 0 {
+			return nil, errTemplateNotFound
+		}
+		if list[i].ID == templates.RetroarchID {
+			return nil, errBuiltinTemplate
+		}
+		tmpl = list[i]
+		edit(&tmpl)
+		tmpl.ID = list[i].ID
+		if fields := templates.Validate(&tmpl, list); len(fields) > 0 {
+			return nil, validationError(fields)
+		}
+		list[i] = tmpl
+		return list, nil
+	})
+	return tmpl, err
+}
+
+func (s *Server) registerTemplateAPI(mux *http.ServeMux) {
+	// статус открыт всем, шаблоны меняет только администратор
+	admin := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.requireAdmin(requireJSON(h)))
+	}
+	mux.HandleFunc("GET /api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		state := s.slotState(r)
+		writeJSON(w, http.StatusOK, StatusResponse{
+			Version:          s.version,
+			RetroarchRunning: state.RetroarchRunning,
+			Game:             state.Game,
+			Console:          state.System,
+			Agent:            state.Agent,
+		})
+	})
+	mux.HandleFunc("GET /api/v1/slots", func(w http.ResponseWriter, r *http.Request) {
+		names := s.tracker.Slots()
+		slots := make([]SlotResponse, 0, len(names))
+		for _, name := range names {
+			state := s.tracker.SlotState(name)
+			slots = append(slots, SlotResponse{
+				Slot:             name,
+				RetroarchRunning: state.RetroarchRunning,
+				Game:             state.Game,
+				Console:          state.System,
+				Agent:            state.Agent,
+			})
+		}
+		writeJSON(w, http.StatusOK, slots)
+	})
+	admin("PUT /api/v1/slots/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !tracker.ValidSlotName(name) {
+			writeAPIError(w, http.StatusBadRequest, "invalid slot name", map[string]string{"slot": "use 1-32 letters, digits, '.', '-' and '_'"})
+			return
+		}
+		var body slotRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error(), nil)
+			return
+		}
+		state := tracker.State{Game: body.Game, System: body.Console, RetroarchRunning: body.RetroarchRunning}
+		if !s.tracker.SetSlot(name, state) {
+			writeAPIError(w, http.StatusConflict, "too many slots", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, SlotResponse{
+			Slot:             name,
+			RetroarchRunning: state.RetroarchRunning,
+			Game:             state.Game,
+			Console:          state.System,
+		})
+	})
+	admin("DELETE /api/v1/slots/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !slices.Contains(s.tracker.Slots(), name) {
+			writeAPIError(w, http.StatusNotFound, "slot not found", nil)
+			return
+		}
+		s.tracker.ClearSlot(name)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	admin("GET /api/v1/templates", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.tracker.Templates())
+	})
+	admin("GET /api/v1/templates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		list := s.tracker.Templates()
+		i := templates.Find(list, r.PathValue("id"))
+		if i < 0 {
+			writeAPIError(w, http.StatusNotFound, "template not found", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, list[i])
+	})
+	admin("POST /api/v1/templates", func(w http.ResponseWriter, r *http.Request) {
+		var tmpl templates.Template
+		if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error(), nil)
+			return
+		}
+		tmpl.ID = templates.NewID()
+		err := s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			if fields := templates.Validate(&tmpl, list); len(fields) > 0 {
+				return nil, validationError(fields)
+			}
+			return append(list, tmpl), nil
+		})
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		slog.Info("Template created via API", "id", tmpl.ID)
+		writeJSON(w, http.StatusCreated, tmpl)
+	})
+	admin("PUT /api/v1/templates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var body templates.Template
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error(), nil)
+			return
+		}
+		tmpl, err := s.editTemplate(r.PathValue("id"), func(t *templates.Template) { *t = body })
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		slog.Info("Template updated via API", "id", tmpl.ID)
+		writeJSON(w, http.StatusOK, tmpl)
+	})
+	admin("PATCH /api/v1/templates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var patch templatePatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON: "+err.Error(), nil)
+			return
+		}
+		tmpl, err := s.editTemplate(r.PathValue("id"), func(t *templates.Template) {
+			if patch.ProcessName != nil {
+				t.ProcessName = *patch.ProcessName
+			}
+			if patch.WindowTitle != nil {
+				t.WindowTitle = *patch.WindowTitle
+			}
+			if patch.System != nil {
+				t.System = *patch.System
+			}
+			if patch.Game != nil {
+				t.Game = *patch.Game
+			}
+			if patch.NamedTitles != nil {
+				t.NamedTitles = *patch.NamedTitles
+			}
+			if patch.NamedBoxarts != nil {
+				t.NamedBoxarts = *patch.NamedBoxarts
+			}
+			if patch.Priority != nil {
+				t.Priority = *patch.Priority
+			}
+		})
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		slog.Info("Template updated via API", "id", tmpl.ID)
+		writeJSON(w, http.StatusOK, tmpl)
+	})
+	admin("GET /api/v1/templates/export", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := ExportPack(&buf, s.tracker, r.URL.Query()["id"]); err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="templates.zip"`)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			slog.Warn("Error sending template pack", "err", err)
+		}
+	})
+	mux.HandleFunc("POST /api/v1/templates/import", s.requireAdmin(requireMediaType("application/zip", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		mode := query.Get("conflict")
+		if mode == "" {
+			mode = templates.ConflictSkip
+		}
+		if !slices.Contains(templates.ConflictModes, mode) {
+			writeAPIError(w, http.StatusBadRequest, "conflict must be skip, overwrite or rename", nil)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+		pack, err := ReadPack(r.Body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		results, err := ImportPack(s.tracker, pack, mode, dryRun)
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, importResponse{DryRun: dryRun, Conflict: mode, Results: results})
+	})))
+	admin("DELETE /api/v1/templates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			i := templates.Find(list, id)
+			if i < 0 {
+				return nil, errTemplateNotFound
+			}
+			if list[i].ID == templates.RetroarchID {
+				return nil, errBuiltinTemplate
+			}
+			return append(list[:i:i], list[i+1:]...), nil
+		})
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		slog.Info("Template deleted via API", "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
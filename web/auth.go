@@ -0,0 +1,183 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"WatchdogRetroArch/i18n"
+)
+
+// adminCookie remembers a browser that logged in with admin_token.
+const adminCookie = "trackgamename_admin"
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>TrackGameName - {{.T.login}}</title>
+</head>
+<body style="font-family: sans-serif; max-width: 400px; margin: 80px auto;">
+	<h2>{{.T.login}}</h2>
+	{{if .Failed}}<p style="color: #c00;">{{.T.login_failed}}</p>{{end}}
+	<form method="POST" action="/login">
+		<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+		<input type="hidden" name="next" value="{{.Next}}">
+		<p><label>{{.T.admin_token}}: <input type="password" name="token" autofocus></label></p>
+		<p><input type="submit" value="{{.T.login}}"></p>
+	</form>
+	<p><a href="/">{{.T.home}}</a></p>
+</body>
+</html>`))
+
+// tokenHash is what the admin cookie holds, so the token itself never sits
+// in the browser.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte("trackgamename:" + token))
+	return hex.EncodeToString(sum[:])
+}
+
+func setAdminCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookie,
+		Value:    tokenHash(token),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func equalSecret(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// isAdmin reports whether r may change settings. Without admin_token every
+// request may, which is only reachable from this computer by default.
+func (s *Server) isAdmin(r *http.Request) bool {
+	token := s.tracker.Config().AdminToken
+	if token == "" {
+		return true
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && equalSecret(bearer, token) {
+		return true
+	}
+	if cookie, err := r.Cookie(adminCookie); err == nil && equalSecret(cookie.Value, tokenHash(token)) {
+		return true
+	}
+	return false
+}
+
+// requireAdmin lets only admins through to h. Pages redirect to the login
+// form, the API answers 401.
+func (s *Server) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.isAdmin(r) {
+			h(w, r)
+			return
+		}
+		slog.Debug("Unauthorized request", "path", r.URL.Path, "remote", r.RemoteAddr)
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.Method != http.MethodGet {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="TrackGameName"`)
+			writeAPIError(w, http.StatusUnauthorized, "admin token required", nil)
+			return
+		}
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+	}
+}
+
+// safeNext keeps the redirect after login on this server.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, `/\`) {
+		return "/settings"
+	}
+	return next
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	failed := false
+	next := safeNext(r.URL.Query().Get("next"))
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		next = safeNext(r.FormValue("next"))
+		if cfg.AdminToken == "" || equalSecret(r.FormValue("token"), cfg.AdminToken) {
+			setAdminCookie(w, r, cfg.AdminToken)
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		slog.Warn("Failed admin login", "remote", r.RemoteAddr)
+		failed = true
+	}
+
+	translations, ok := s.translations(w, cfg.Language)
+	if !ok {
+		return
+	}
+	// cookie нужно выставить до WriteHeader
+	token := csrfToken(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if failed {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	data := struct {
+		Next   string
+		Failed bool
+		CSRF   string
+		T      i18n.Translations
+	}{Next: next, Failed: failed, CSRF: token, T: translations}
+	if err := loginPage.Execute(w, data); err != nil {
+		slog.Error("Error rendering login page", "err", err)
+	}
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// checkOrigin accepts WebSocket connections from pages served by this server
+// and from clients that send no Origin at all, such as OBS plugins. Browsers
+// always send one, so other sites cannot talk to the WebSocket.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	// localhost и 127.0.0.1 — один и тот же компьютер
+	originHost, originPort, err1 := net.SplitHostPort(u.Host)
+	host, port, err2 := net.SplitHostPort(r.Host)
+	if err1 != nil || err2 != nil || originPort != port {
+		slog.Warn("Rejected WebSocket from foreign origin", "origin", origin)
+		return false
+	}
+	if isLoopbackHost(originHost) && isLoopbackHost(host) {
+		return true
+	}
+	slog.Warn("Rejected WebSocket from foreign origin", "origin", origin)
+	return false
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+const (
+	// csrfCookie holds a random token that every form sends back in
+	// csrfField. Another site can make the browser post a form here, but it
+	// cannot read the cookie to fill in the field.
+	csrfCookie = "trackgamename_csrf"
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+
+	// maxFormSize limits the body of a form post without files.
+	maxFormSize = 1 << 20
+	// maxThumbnailFormSize limits a form post with two thumbnails.
+	maxThumbnailFormSize = 2*maxUploadSize + maxFormSize
+)
+
+// csrfToken returns the token for the forms on the page being rendered,
+// issuing the cookie on the first visit.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		slog.Error("Error generating CSRF token", "err", err)
+		return ""
+	}
+	token := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	sent := r.Header.Get(csrfHeader)
+	if sent == "" {
+		sent = r.PostFormValue(csrfField)
+	}
+	return sent != "" && equalSecret(sent, cookie.Value)
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// requireCSRF rejects form posts that do not carry the token of a page
+// served by this server. The body is limited to maxBody bytes and parsed
+// here, because the token may be one of its fields.
+func requireCSRF(maxBody int64, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) {
+			h(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		if err := parseForm(r, maxBody); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Form is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			slog.Error("Error parsing form", "path", r.URL.Path, "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		if !validCSRF(r) {
+			slog.Warn("Rejected form without CSRF token", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "Missing or invalid CSRF token, reload the page and try again", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// parseForm reads a url-encoded or multipart form body. Files of a multipart
+// form above maxMemory go to temporary files.
+func parseForm(r *http.Request, maxMemory int64) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return r.ParseMultipartForm(maxMemory)
+	}
+	return r.ParseForm()
+}
+
+// requireJSON only lets requests with a JSON body change data through the
+// API. Browsers cannot send them cross-site without asking the server first,
+// and the server never allows that.
+func requireJSON(h http.HandlerFunc) http.HandlerFunc {
+	return requireMediaType("application/json", h)
+}
+
+// requireMediaType is requireJSON for another body type that a cross-site
+// form cannot send, such as application/zip.
+func requireMediaType(want string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) && r.Method != http.MethodDelete {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != want {
+				writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+want, nil)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
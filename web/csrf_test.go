@@ -0,0 +1,65 @@
+package web
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRequireCSRF(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	// токен в поле формы, а не в заголовке: его приходится искать в теле
+	multipartBody := func(token string, size int) (string, []byte) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField(csrfField, token)
+		mw.WriteField("process_name_display", "Game.exe")
+		file, _ := mw.CreateFormFile("named_titles", "big.png")
+		file.Write(bytes.Repeat([]byte("x"), size))
+		mw.Close()
+		return mw.FormDataContentType(), buf.Bytes()
+	}
+	urlencoded := func(token string, size int) (string, []byte) {
+		form := url.Values{csrfField: {token}, "padding": {strings.Repeat("x", size)}}
+		return "application/x-www-form-urlencoded", []byte(form.Encode())
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   func(token string, size int) (string, []byte)
+		token  string
+		size   int
+		status int
+	}{
+		{"settings form too large", "/settings", urlencoded, csrfTestToken, maxFormSize, http.StatusRequestEntityTooLarge},
+		{"settings form without token", "/settings", urlencoded, "", 10, http.StatusForbidden},
+		{"settings form with wrong token", "/settings", urlencoded, strings.Repeat("0", 64), 10, http.StatusForbidden},
+		{"template form too large", "/settings-games", multipartBody, csrfTestToken, maxThumbnailFormSize, http.StatusRequestEntityTooLarge},
+		{"template form with token", "/settings-games", multipartBody, csrfTestToken, 10, http.StatusOK},
+		{"template form without token", "/settings-games", multipartBody, "", 10, http.StatusForbidden},
+		{"login form too large", "/login", urlencoded, csrfTestToken, maxFormSize, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body := tt.body(tt.token, tt.size)
+			req, err := http.NewRequest("POST", ts.http.URL+tt.path, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			req.AddCookie(&http.Cookie{Name: csrfCookie, Value: csrfTestToken})
+			resp, err := ts.http.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package web
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"WatchdogRetroArch/agent"
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/retroarch"
+)
+
+// Check results, from best to worst.
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// CheckResult is one line of the diagnostics report. Name is a translation key.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+var thumbnailSizePattern = regexp.MustCompile(`^(0|\d*x\d*)$`)
+
+// RunChecks validates cfg and the files it points to. serverRunning tells the
+// port check that the web server is ours, so a busy port is expected.
+func RunChecks(cfg config.Config, dirs Dirs, serverRunning bool) []CheckResult {
+	return []CheckResult{
+		checkRetroarchPath(cfg),
+		checkContentHistory(cfg),
+		checkThumbnailsPath(cfg),
+		checkThumbnailSize(cfg),
+		checkTheme(cfg, dirs),
+		checkLanguages(cfg, dirs),
+		checkPort(cfg, serverRunning),
+		checkAccess(cfg),
+		checkTLS(cfg, dirs.Save),
+		checkAgent(cfg),
+		checkSystemIcons(cfg, dirs),
+	}
+}
+
+func checkRetroarchPath(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_retroarch_path"}
+	info, err := os.Stat(cfg.RetroarchPath)
+	switch {
+	case cfg.RetroarchPath == "":
+		res.Status, res.Message = CheckWarn, "retroarch_path is empty, only Windows games will be tracked"
+		res.Fix = "Set retroarch_path to your RetroArch folder, e.g. C:\\RetroArch-Win64"
+	case err != nil || !info.IsDir():
+		res.Status, res.Message = CheckFail, fmt.Sprintf("%s is not a folder", cfg.RetroarchPath)
+		res.Fix = "Point retroarch_path to the folder that contains retroarch.exe"
+	default:
+		if _, err := os.Stat(filepath.Join(cfg.RetroarchPath, "retroarch.exe")); err != nil {
+			res.Status, res.Message = CheckWarn, "retroarch.exe not found in "+cfg.RetroarchPath
+			res.Fix = "Make sure retroarch_path is the RetroArch installation folder"
+		} else {
+			res.Status, res.Message = CheckPass, cfg.RetroarchPath
+		}
+	}
+	return res
+}
+
+func checkContentHistory(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_content_history"}
+	if cfg.RetroarchPath == "" {
+		res.Status, res.Message = CheckWarn, "skipped, retroarch_path is empty"
+		return res
+	}
+	lplPath := retroarch.HistoryPath(cfg.RetroarchPath)
+	data, err := os.ReadFile(lplPath)
+	if err != nil {
+		res.Status, res.Message = CheckFail, fmt.Sprintf("cannot read %s: %v", lplPath, err)
+		res.Fix = "Start a game in RetroArch once and check that \"Save history\" is enabled"
+		return res
+	}
+	var playlist struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &playlist); err != nil {
+		res.Status, res.Message = CheckWarn, fmt.Sprintf("%s is not valid JSON: %v", lplPath, err)
+		res.Fix = "Enable the JSON playlist format in RetroArch (Settings > Playlists)"
+		return res
+	}
+	if len(playlist.Items) == 0 {
+		res.Status, res.Message = CheckWarn, "history is empty"
+		res.Fix = "Start a game in RetroArch once"
+		return res
+	}
+	res.Status, res.Message = CheckPass, fmt.Sprintf("%d entries", len(playlist.Items))
+	return res
+}
+
+func checkThumbnailsPath(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_thumbnails_path"}
+	if !cfg.EnableThumbnails {
+		res.Status, res.Message = CheckPass, "thumbnails are disabled"
+		return res
+	}
+	entries, err := os.ReadDir(cfg.ThumbnailsPath)
+	if cfg.ThumbnailsPath == "" || err != nil {
+		res.Status, res.Message = CheckFail, fmt.Sprintf("cannot read thumbnails_path %q", cfg.ThumbnailsPath)
+		res.Fix = "Set thumbnails_path to RetroArch's thumbnails folder or disable thumbnails"
+		return res
+	}
+	systems := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		for _, kind := range retroarch.ThumbnailFolders(retroarch.ThumbnailTypes) {
+			if info, err := os.Stat(filepath.Join(cfg.ThumbnailsPath, e.Name(), kind)); err == nil && info.IsDir() {
+				systems++
+				break
+			}
+		}
+	}
+	if unknown := slices.DeleteFunc(slices.Clone(cfg.ThumbnailTypes), func(t string) bool {
+		_, ok := retroarch.ThumbnailFolder(t)
+		return ok
+	}); len(unknown) > 0 {
+		res.Status, res.Message = CheckWarn, "unknown thumbnail_types: "+strings.Join(unknown, ", ")
+		res.Fix = "Use title, boxart, snap and logo in thumbnail_types"
+		return res
+	}
+	if systems == 0 {
+		res.Status, res.Message = CheckWarn, "no <system>/Named_Titles, Named_Boxarts, Named_Snaps or Named_Logos folders found"
+		res.Fix = "Use the RetroArch layout: <thumbnails_path>\\<system>\\Named_Titles\\<game>.png"
+		return res
+	}
+	res.Status, res.Message = CheckPass, fmt.Sprintf("%d systems with thumbnails", systems)
+	return res
+}
+
+func checkThumbnailSize(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_thumbnail_size"}
+	size := strings.TrimSpace(cfg.ThumbnailSize)
+	if size == "" || thumbnailSizePattern.MatchString(size) {
+		res.Status, res.Message = CheckPass, fmt.Sprintf("%q", size)
+		return res
+	}
+	res.Status, res.Message = CheckFail, fmt.Sprintf("%q is not a valid size", size)
+	res.Fix = "Use WIDTHxHEIGHT, WIDTHx, xHEIGHT or 0, e.g. 200x200"
+	return res
+}
+
+func checkTheme(cfg config.Config, dirs Dirs) CheckResult {
+	res := CheckResult{Name: "check_theme"}
+	themeDir := filepath.Join(dirs.Theme, cfg.Theme)
+	if _, err := os.Stat(themeDir); err != nil {
+		res.Status, res.Message = CheckFail, fmt.Sprintf("theme folder %s not found", themeDir)
+		res.Fix = "Pick an existing theme on the settings page"
+		return res
+	}
+	if _, err := ParseTheme(dirs.Theme, cfg.Theme); err != nil {
+		res.Status, res.Message = CheckFail, err.Error()
+		res.Fix = "Fix the template or delete it from the theme folder to use the default one"
+		return res
+	}
+	var inherited []string
+	for _, file := range append(ThemeFiles, "styles.css") {
+		if _, err := os.Stat(filepath.Join(themeDir, file)); err != nil {
+			inherited = append(inherited, file)
+		}
+	}
+	if cfg.Theme != "default" && len(inherited) > 0 {
+		res.Status, res.Message = CheckPass, "uses default for: "+strings.Join(inherited, ", ")
+		return res
+	}
+	if cfg.Theme == "default" && len(inherited) > 0 {
+		res.Status, res.Message = CheckFail, "default theme is missing: "+strings.Join(inherited, ", ")
+		res.Fix = "Reinstall TrackGameName to restore Theme\\default"
+		return res
+	}
+	res.Status, res.Message = CheckPass, cfg.Theme
+	return res
+}
+
+func checkLanguages(cfg config.Config, dirs Dirs) CheckResult {
+	res := CheckResult{Name: "check_languages"}
+	reference, _, err := i18n.Load(dirs.Lang, "en")
+	if err != nil {
+		res.Status, res.Message = CheckFail, err.Error()
+		res.Fix = "Restore lang\\en.json"
+		return res
+	}
+	if _, _, err := i18n.Load(dirs.Lang, cfg.Language); err != nil {
+		res.Status, res.Message = CheckFail, err.Error()
+		res.Fix = "Pick another language on the settings page"
+		return res
+	}
+	var problems []string
+	for _, lang := range i18n.Available(dirs.Lang) {
+		t, _, err := i18n.Load(dirs.Lang, lang.Code)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		missing := 0
+		for key := range reference {
+			if _, ok := t[key]; !ok {
+				missing++
+			}
+		}
+		if missing > 0 {
+			problems = append(problems, fmt.Sprintf("%s.json is missing %d keys", lang.Code, missing))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		res.Status, res.Message = CheckWarn, strings.Join(problems, "; ")
+		res.Fix = "Missing keys are shown empty; copy them from lang\\en.json"
+		return res
+	}
+	res.Status, res.Message = CheckPass, cfg.Language
+	return res
+}
+
+func checkPort(cfg config.Config, serverRunning bool) CheckResult {
+	res := CheckResult{Name: "check_port"}
+	if serverRunning {
+		res.Status, res.Message = CheckPass, fmt.Sprintf("serving on port %d", cfg.WebPort)
+		return res
+	}
+	ln, err := net.Listen("tcp", config.ListenAddr(cfg))
+	if err != nil {
+		res.Status, res.Message = CheckFail, fmt.Sprintf("port %d is busy: %v", cfg.WebPort, err)
+		res.Fix = "Close the program using the port or change web_port"
+		return res
+	}
+	_ = ln.Close()
+	res.Status, res.Message = CheckPass, fmt.Sprintf("port %d is free", cfg.WebPort)
+	return res
+}
+
+func checkTLS(cfg config.Config, savePath string) CheckResult {
+	res := CheckResult{Name: "check_tls"}
+	if !cfg.HTTPS {
+		res.Status, res.Message = CheckPass, "HTTPS is off"
+		return res
+	}
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		certFile, _ := SelfSignedPaths(savePath)
+		res.Status, res.Message = CheckPass, "self-signed certificate "+certFile
+		return res
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		res.Status, res.Message = CheckFail, err.Error()
+		res.Fix = "Check tls_cert_file and tls_key_file, or clear both to use a self-signed certificate"
+		return res
+	}
+	if left := time.Until(cert.Leaf.NotAfter); left < 0 {
+		res.Status, res.Message = CheckFail, "certificate expired on "+cert.Leaf.NotAfter.Format(time.DateOnly)
+		res.Fix = "Renew the certificate in tls_cert_file"
+		return res
+	} else if left < renewBefore {
+		res.Status, res.Message = CheckWarn, "certificate expires on "+cert.Leaf.NotAfter.Format(time.DateOnly)
+		res.Fix = "Renew the certificate in tls_cert_file"
+		return res
+	}
+	res.Status, res.Message = CheckPass, cfg.TLSCertFile
+	return res
+}
+
+func checkAgent(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_agent"}
+	switch {
+	case cfg.AgentURL != "" && !agent.ValidURL(cfg.AgentURL):
+		res.Status, res.Message = CheckFail, fmt.Sprintf("agent_url %q is not a valid address", cfg.AgentURL)
+		res.Fix = "Use the address of the other TrackGameName, e.g. http://192.168.1.10:3489"
+	case cfg.AgentURL != "" && cfg.AgentToken == "":
+		res.Status, res.Message = CheckFail, "agent_url is set without agent_token"
+		res.Fix = "Set agent_token to the same value as on the receiving side"
+	case cfg.AgentURL != "" && cfg.AgentCAFile != "":
+		if _, err := os.Stat(cfg.AgentCAFile); err != nil {
+			res.Status, res.Message = CheckFail, fmt.Sprintf("cannot read agent_ca_file: %v", err)
+			res.Fix = "Copy tls\\cert.pem from the receiving side and point agent_ca_file to it"
+			return res
+		}
+		res.Status, res.Message = CheckPass, "sending to "+cfg.AgentURL
+	case cfg.AgentURL != "":
+		res.Status, res.Message = CheckPass, "sending to "+cfg.AgentURL
+	case cfg.AgentToken != "" && config.IsLocalOnly(cfg):
+		res.Status, res.Message = CheckWarn, "agent_token is set, but agents on other computers cannot reach "+config.ListenAddr(cfg)
+		res.Fix = "Set bind_address to 0.0.0.0 or the address of this computer"
+	case cfg.AgentToken != "":
+		res.Status, res.Message = CheckPass, "accepting agents on "+config.ListenAddr(cfg)
+	default:
+		res.Status, res.Message = CheckPass, "agent mode is off"
+	}
+	return res
+}
+
+func checkAccess(cfg config.Config) CheckResult {
+	res := CheckResult{Name: "check_access"}
+	if !config.IsLocalOnly(cfg) && cfg.AdminToken == "" {
+		res.Status, res.Message = CheckWarn, fmt.Sprintf("listening on %s without admin_token", cfg.BindAddress)
+		res.Fix = "Set admin_token in config.ini or bind_address=127.0.0.1"
+		return res
+	}
+	res.Status, res.Message = CheckPass, config.ListenAddr(cfg)
+	return res
+}
+
+func checkSystemIcons(cfg config.Config, dirs Dirs) CheckResult {
+	res := CheckResult{Name: "check_system_icons"}
+	if len(cfg.Systems) == 0 {
+		res.Status, res.Message = CheckPass, "no [systems] icons configured"
+		return res
+	}
+	var missing []string
+	for system, icon := range cfg.Systems {
+		if _, err := os.Stat(filepath.Join(dirs.Systems, icon)); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", icon, system))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		res.Status, res.Message = CheckWarn, "missing icons: "+strings.Join(missing, ", ")
+		res.Fix = "Put the icon files into " + dirs.Systems
+		return res
+	}
+	res.Status, res.Message = CheckPass, fmt.Sprintf("%d icons", len(cfg.Systems))
+	return res
+}
+
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	translations, ok := s.translations(w, cfg.Language)
+	if !ok {
+		return
+	}
+	data := struct {
+		Theme  string
+		Checks []CheckResult
+		T      i18n.Translations
+	}{
+		Theme:  cfg.Theme,
+		Checks: RunChecks(cfg, s.dirs, true),
+		T:      translations,
+	}
+	s.render(w, "diagnostics.html", data)
+}
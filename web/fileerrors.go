@@ -0,0 +1,40 @@
+package web
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+var fileErrorPage = template.Must(template.New("file-errors").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>TrackGameName - file error</title>
+</head>
+<body style="font-family: sans-serif; max-width: 800px; margin: 40px auto;">
+	<h2>TrackGameName could not load its data files</h2>
+	{{range .}}
+	<div style="border: 1px solid #c00; padding: 10px; margin-bottom: 10px;">
+		<p><b>{{.File}}</b></p>
+		<pre style="white-space: pre-wrap;">{{.Err}}</pre>
+	</div>
+	{{end}}
+	<p>The file was not changed. Fix or remove it; this page disappears as soon as the file loads.</p>
+</body>
+</html>`))
+
+// renderFileErrors shows the file error page if any data file failed to load
+// and reports whether it did.
+func (s *Server) renderFileErrors(w http.ResponseWriter) bool {
+	fileErrors := s.tracker.FileErrors()
+	if len(fileErrors) == 0 {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	if err := fileErrorPage.Execute(w, fileErrors); err != nil {
+		slog.Error("Error rendering file error page", "err", err)
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+package web
+
+import "net/http"
+
+func (s *Server) registerMetrics(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		res, status := s.metrics.Health()
+		writeJSON(w, status, res)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.metrics.WritePrometheus(w, s.hub.screens())
+	})
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/logging"
+)
+
+// handleLogs shows the most recent log entries. ?level= filters by minimum
+// level, ?limit= caps the count and ?format=text or json returns them for
+// pasting into a support request.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	minLevel := slog.LevelDebug
+	if value := r.URL.Query().Get("level"); value != "" {
+		if level, err := logging.ParseLevel(value); err == nil {
+			minLevel = level
+		}
+	}
+	limit := 200
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	entries := logging.Recent(minLevel, limit)
+
+	switch r.URL.Query().Get("format") {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, e := range entries {
+			fmt.Fprintln(w, e.String())
+		}
+		return
+	case "json":
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	cfg := s.tracker.Config()
+	translations, ok := s.translations(w, cfg.Language)
+	if !ok {
+		return
+	}
+	data := struct {
+		Theme   string
+		Entries []logging.Entry
+		Level   string
+		Limit   int
+		Levels  []string
+		LogFile string
+		T       i18n.Translations
+	}{
+		Theme:   cfg.Theme,
+		Entries: entries,
+		Level:   strings.ToLower(minLevel.String()),
+		Limit:   limit,
+		Levels:  []string{"debug", "info", "warn", "error"},
+		LogFile: logging.FilePath(),
+		T:       translations,
+	}
+	s.render(w, "logs.html", data)
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+// maxPackSize limits an uploaded template pack.
+const maxPackSize = 100 << 20
+
+// ExportPack writes the templates with the given IDs, or all of them when ids
+// is empty, as a template pack together with the thumbnails they point to.
+// The built-in RetroArch template is never exported.
+func ExportPack(w io.Writer, t *tracker.Tracker, ids []string) error {
+	list := t.Templates()
+	for _, id := range ids {
+		if templates.Find(list, id) < 0 {
+			return fmt.Errorf("%w: %s", errTemplateNotFound, id)
+		}
+	}
+	thumbnailsPath := t.Config().ThumbnailsPath
+	pack := templates.Pack{Images: make(map[string][]byte)}
+	for _, tmpl := range list {
+		if tmpl.ID == templates.RetroarchID || len(ids) > 0 && !slices.Contains(ids, tmpl.ID) {
+			continue
+		}
+		for _, rel := range []string{tmpl.NamedTitles, tmpl.NamedBoxarts} {
+			if rel == "" || thumbnailsPath == "" {
+				continue
+			}
+			if !templates.ValidThumbnailPath(rel) {
+				slog.Warn("Thumbnail left out of the pack", "template", tmpl.ID, "path", rel, "err", "unexpected path")
+				continue
+			}
+			data, err := t.FS().ReadFile(filepath.Join(thumbnailsPath, filepath.FromSlash(rel)))
+			if err != nil {
+				slog.Warn("Thumbnail left out of the pack", "template", tmpl.ID, "path", rel, "err", err)
+				continue
+			}
+			pack.Images[rel] = data
+		}
+		pack.Templates = append(pack.Templates, tmpl)
+	}
+	return templates.WritePack(w, pack)
+}
+
+// ReadPack reads a template pack of at most maxPackSize bytes and checks its
+// images like uploads.
+func ReadPack(r io.Reader) (templates.Pack, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPackSize+1))
+	if err != nil {
+		return templates.Pack{}, err
+	}
+	if len(data) > maxPackSize {
+		return templates.Pack{}, fmt.Errorf("template pack is larger than %d MB", maxPackSize>>20)
+	}
+	pack, err := templates.ReadPack(bytes.NewReader(data), int64(len(data)), maxUploadSize)
+	if err != nil {
+		return templates.Pack{}, err
+	}
+	for rel, img := range pack.Images {
+		decoded, err := decodeThumbnail(bytes.NewReader(img))
+		if err != nil {
+			return templates.Pack{}, fmt.Errorf("%s: %v", rel, err)
+		}
+		pack.Images[rel] = decoded
+	}
+	return pack, nil
+}
+
+// ImportPack adds the templates of a pack read by ReadPack to games.json,
+// with mode deciding what happens to templates that already exist, and writes
+// their thumbnails into thumbnails_path. With dryRun nothing is written and
+// the result tells what would happen.
+func ImportPack(t *tracker.Tracker, pack templates.Pack, mode string, dryRun bool) ([]templates.ImportResult, error) {
+	if dryRun {
+		_, results, err := templates.Import(t.Templates(), pack, mode)
+		return results, err
+	}
+
+	var results []templates.ImportResult
+	err := t.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		merged, res, err := templates.Import(list, pack, mode)
+		results = res
+		return merged, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	thumbnailsPath := t.Config().ThumbnailsPath
+	for i := range results {
+		for dst, src := range results[i].Images {
+			parts := strings.Split(dst, "/")
+			_, err := writeThumbnail(thumbnailsPath, parts[0], strings.ToLower(parts[1]), strings.TrimSuffix(parts[2], ".png"), pack.Images[src])
+			if err != nil {
+				slog.Error("Error saving imported thumbnail", "path", dst, "err", err)
+				if results[i].Errors == nil {
+					results[i].Errors = make(map[string]string)
+				}
+				results[i].Errors[dst] = err.Error()
+			}
+		}
+	}
+	slog.Info("Imported template pack", "templates", len(pack.Templates), "conflict", mode)
+	return results, nil
+}
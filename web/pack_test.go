@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"WatchdogRetroArch/templates"
+)
+
+func TestTemplatePackAPI(t *testing.T) {
+	// первый сервер отдаёт набор, второй его принимает
+	from := newTestServer(t, testConfig(t))
+	thumbnails := from.tracker.Config().ThumbnailsPath
+	if err := os.MkdirAll(filepath.Join(thumbnails, "Windows", "Named_Titles"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(thumbnails, "Windows", "Named_Titles", "Game.png"), testPNG(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := from.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		return append(list,
+			templates.Template{ID: "game", ProcessName: "Game.exe", WindowTitle: "Game", System: "Windows", Game: "Game",
+				NamedTitles: "Windows/Named_Titles/Game.png"},
+			templates.Template{ID: "other", ProcessName: "Other.exe", System: "Windows", Game: "Other"},
+		), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := from.do(t, "GET", "/api/v1/templates/export?id=missing", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("export of unknown id: %s", resp.Status)
+	}
+	resp := from.do(t, "GET", "/api/v1/templates/export?id=game", "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	pack, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to := newTestServer(t, testConfig(t))
+	if resp := to.do(t, "POST", "/api/v1/templates/import", "application/json", pack); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("import as JSON: %s", resp.Status)
+	}
+	if resp := to.do(t, "POST", "/api/v1/templates/import?conflict=merge", "application/zip", pack); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown conflict mode: %s", resp.Status)
+	}
+	if resp := to.do(t, "POST", "/api/v1/templates/import", "application/zip", []byte("not a zip")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("broken pack: %s", resp.Status)
+	}
+
+	importPack := func(query string) importResponse {
+		t.Helper()
+		resp := to.do(t, "POST", "/api/v1/templates/import"+query, "application/zip", pack)
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("import%s: %s %s", query, resp.Status, body)
+		}
+		var res importResponse
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	imported := filepath.Join(to.tracker.Config().ThumbnailsPath, "Windows", "Named_Titles", "Game.png")
+
+	res := importPack("?dry_run=true")
+	if !res.DryRun || len(res.Results) != 1 || res.Results[0].Action != templates.ActionAdd {
+		t.Fatalf("dry run: %+v", res)
+	}
+	if len(to.tracker.Templates()) != 1 {
+		t.Errorf("dry run added templates: %+v", to.tracker.Templates())
+	}
+	if _, err := os.Stat(imported); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s", imported)
+	}
+
+	res = importPack("")
+	if res.Conflict != templates.ConflictSkip || res.Results[0].Action != templates.ActionAdd {
+		t.Fatalf("import: %+v", res)
+	}
+	if _, err := os.Stat(imported); err != nil {
+		t.Errorf("thumbnail not imported: %v", err)
+	}
+	res = importPack("?conflict=rename")
+	if res.Results[0].Action != templates.ActionRename || res.Results[0].RenamedTo != "Game (2)" {
+		t.Fatalf("rename: %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(imported), "Game (2).png")); err != nil {
+		t.Errorf("renamed thumbnail not written: %v", err)
+	}
+	// RetroArch, Game и Game (2)
+	if got := len(to.tracker.Templates()); got != 3 {
+		t.Errorf("got %d templates after import, want 3", got)
+	}
+}
@@ -0,0 +1,327 @@
+package web
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/tracker"
+)
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if s.renderFileErrors(w) {
+		return
+	}
+	cfg := s.tracker.Config()
+	state := s.tracker.State()
+	translations, ok := s.translations(w, cfg.Language)
+	if !ok {
+		return
+	}
+	data := struct {
+		Running                 bool
+		CurrentGame             string
+		CurrentConsole          string
+		Theme                   string
+		T                       i18n.Translations
+		EnableThumbnails        bool
+		ThumbnailPaths          []string
+		ThumbnailWidth          string
+		ThumbnailHeight         string
+		AlternateThumbnails     bool
+		ThumbnailSwitchInterval int
+		Version                 string
+		Port                    int
+		AgentsAccepted          bool
+		Agent                   string
+		Slots                   []SlotResponse
+	}{
+		Running:                 state.RetroarchRunning,
+		CurrentGame:             state.Game,
+		CurrentConsole:          state.System,
+		AgentsAccepted:          cfg.AgentToken != "",
+		Agent:                   state.Agent,
+		Theme:                   cfg.Theme,
+		T:                       translations,
+		EnableThumbnails:        cfg.EnableThumbnails,
+		ThumbnailPaths:          []string{},
+		ThumbnailWidth:          "",
+		ThumbnailHeight:         "",
+		AlternateThumbnails:     cfg.AlternateThumbnails,
+		ThumbnailSwitchInterval: cfg.ThumbnailSwitchInterval,
+		Version:                 s.version,
+		Port:                    cfg.WebPort,
+	}
+	for _, name := range s.tracker.Slots() {
+		slot := s.tracker.SlotState(name)
+		data.Slots = append(data.Slots, SlotResponse{Slot: name, Game: slot.Game, Console: slot.System, Agent: slot.Agent})
+	}
+	thumbnailPaths, thumbnailWidth, thumbnailHeight := s.thumbnailPaths(cfg, state, retroarch.ThumbnailFolders(cfg.ThumbnailTypes))
+	data.ThumbnailPaths = thumbnailPaths
+	data.ThumbnailWidth = thumbnailWidth
+	data.ThumbnailHeight = thumbnailHeight
+	s.render(w, "index.html", data)
+	footer := `
+        <script>
+            var container = document.querySelector(".container.index-container");
+            if (container) {
+                container.innerHTML += '<div id="donate-section" style="text-align: center; padding: 10px; font-size: 14px;">' +
+                    '<p class="donate-text">Please consider supporting the project with a donation: <a class="donate-link" href="https://www.donationalerts.com/r/ork8bit">DonationAlerts</a>' +
+                    '<img src="/theme/heart.png" alt="Heart" class="donate-heart"></p>' +
+                    '<p class="donate-text">©ork8bit aka Dmitriy Anatolyevich | <a class="donate-link" href="mailto:dmitrius.true@proton.me">dmitrius.true@proton.me</a></p>' +
+                    '</div>';
+            }
+            function protectFooter() {
+                var container = document.querySelector(".container.index-container");
+                var footer = document.getElementById("donate-section");
+                if (!footer || footer.style.display === "none" || !container.querySelector("#donate-section")) {
+                    container.innerHTML += '<div id="donate-section" style="text-align: center; padding: 10px; font-size: 14px;">' +
+                        '<p class="donate-text">Please consider supporting the project with a donation: <a class="donate-link" href="https://www.donationalerts.com/r/ork8bit">DonationAlerts</a>' +
+                        '<img src="/theme/heart.png" alt="Heart" class="donate-heart"></p>' +
+                        '<p class="donate-text">©ork8bit aka Dmitriy Anatolyevich | <a class="donate-link" href="mailto:dmitrius.true@proton.me">dmitrius.true@proton.me</a></p>' +
+                        '</div>';
+                }
+            }
+            setInterval(protectFooter, 1000);
+        </script>
+    `
+	if _, err := w.Write([]byte(footer)); err != nil {
+		slog.Warn("failed to write footer", "err", err)
+	}
+}
+
+// slotState returns the state of the slot a widget asks for with ?slot=, or
+// of the default slot without it.
+func (s *Server) slotState(r *http.Request) tracker.State {
+	return s.tracker.SlotState(r.URL.Query().Get("slot"))
+}
+
+func (s *Server) handleGame(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	data := struct {
+		CurrentGame string
+		Theme       string
+		Port        int
+	}{
+		CurrentGame: s.slotState(r).Game,
+		Theme:       cfg.Theme,
+		Port:        cfg.WebPort,
+	}
+	s.render(w, "game.html", data)
+}
+
+// systemIcon returns the [systems] icon of system when icons are enabled.
+func systemIcon(cfg config.Config, system string) string {
+	if cfg.SystemIcon > 0 && system != "" {
+		if iconFile, exists := cfg.Systems[system]; exists {
+			return iconFile
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	state := s.slotState(r)
+	data := struct {
+		SystemIcon     int
+		CurrentConsole string
+		IconFile       string
+		Theme          string
+		Port           int
+	}{
+		SystemIcon:     cfg.SystemIcon,
+		CurrentConsole: state.System,
+		IconFile:       systemIcon(cfg, state.System),
+		Theme:          cfg.Theme,
+		Port:           cfg.WebPort,
+	}
+	s.render(w, "system.html", data)
+}
+
+func (s *Server) handleAll(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	state := s.slotState(r)
+	data := struct {
+		SystemIcon     int
+		CurrentConsole string
+		CurrentGame    string
+		IconFile       string
+		Theme          string
+		Port           int
+	}{
+		SystemIcon:     cfg.SystemIcon,
+		CurrentConsole: state.System,
+		CurrentGame:    state.Game,
+		IconFile:       systemIcon(cfg, state.System),
+		Theme:          cfg.Theme,
+		Port:           cfg.WebPort,
+	}
+	s.render(w, "all.html", data)
+}
+
+// handleThumbnailFile serves a file from thumbnails_path. The folder is looked
+// up per request, so a changed setting applies without a restart.
+func (s *Server) handleThumbnailFile(w http.ResponseWriter, r *http.Request) {
+	dir := s.tracker.Config().ThumbnailsPath
+	if dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+}
+
+func (s *Server) handleThumbnails(w http.ResponseWriter, r *http.Request) {
+	cfg := s.tracker.Config()
+	state := s.slotState(r)
+	kinds := retroarch.ThumbnailFolders(cfg.ThumbnailTypes)
+	if t := r.URL.Query().Get("type"); t != "" {
+		folder, ok := retroarch.ThumbnailFolder(t)
+		if !ok {
+			http.Error(w, "unknown thumbnail type, use one of: "+strings.Join(retroarch.ThumbnailTypes, ", "), http.StatusBadRequest)
+			return
+		}
+		kinds = []string{folder}
+	}
+	Width, Height := parseSizeToInt(cfg.ThumbnailSize)
+	data := struct {
+		CurrentGame             string
+		Theme                   string
+		ThumbnailPaths          []string
+		ThumbnailWidth          string
+		ThumbnailHeight         string
+		AlternateThumbnails     bool
+		ThumbnailSwitchInterval int
+		FadeDuration            float64
+		FadeType                string
+		Port                    int
+		Width                   int
+		Height                  int
+	}{
+		CurrentGame:             state.Game,
+		Theme:                   cfg.Theme,
+		ThumbnailPaths:          []string{},
+		ThumbnailWidth:          "",
+		ThumbnailHeight:         "",
+		AlternateThumbnails:     cfg.AlternateThumbnails,
+		ThumbnailSwitchInterval: cfg.ThumbnailSwitchInterval,
+		FadeDuration:            cfg.FadeDuration,
+		FadeType:                cfg.FadeType,
+		Port:                    cfg.WebPort,
+		Width:                   Width,
+		Height:                  Height,
+	}
+
+	data.ThumbnailPaths, data.ThumbnailWidth, data.ThumbnailHeight = s.thumbnailPaths(cfg, state, kinds)
+	slog.Debug("Serving /thumbnails", "paths", data.ThumbnailPaths)
+	s.render(w, "thumbnails.html", data)
+}
+
+// thumbnailPaths returns the /thumbnails URLs of the game in state for the
+// folders in kinds, or the theme's noimage.png when it has none, together with
+// the CSS size from thumbnail_size.
+func (s *Server) thumbnailPaths(cfg config.Config, state tracker.State, kinds []string) ([]string, string, string) {
+	var thumbnailPaths []string
+	var thumbnailWidth, thumbnailHeight string
+	if cfg.EnableThumbnails && (cfg.ThumbnailsPath != "" || state.Agent != "") && state.System != "" && state.Game != "" {
+		thumbnailPaths = s.findThumbnails(cfg, state, kinds)
+
+		s.metrics.ThumbnailLookup(len(thumbnailPaths) > 0)
+		if len(thumbnailPaths) == 0 {
+			noImagePath := filepath.Join(s.dirs.Theme, cfg.Theme, "noimage.png")
+			if _, err := os.Stat(noImagePath); !os.IsNotExist(err) {
+				thumbnailPaths = append(thumbnailPaths, fmt.Sprintf("/theme/%s/noimage.png", cfg.Theme))
+			} else {
+				defaultNoImagePath := filepath.Join(s.dirs.Theme, "default", "noimage.png")
+				if _, err := os.Stat(defaultNoImagePath); !os.IsNotExist(err) {
+					thumbnailPaths = append(thumbnailPaths, "/theme/default/noimage.png")
+				} else {
+					slog.Warn("noimage.png not found in theme or default", "theme", cfg.Theme)
+				}
+			}
+		}
+
+		if cfg.ThumbnailSize != "" && cfg.ThumbnailSize != "0" {
+			parts := strings.Split(cfg.ThumbnailSize, "x")
+			if len(parts) == 2 {
+				if parts[0] != "" && parts[1] != "" {
+					thumbnailWidth = parts[0] + "px"
+					thumbnailHeight = parts[1] + "px"
+				} else if parts[0] != "" {
+					thumbnailWidth = parts[0] + "px"
+				} else if parts[1] != "" {
+					thumbnailHeight = parts[1] + "px"
+				}
+			}
+		}
+	}
+	slog.Debug("Thumbnail paths", "paths", thumbnailPaths)
+	return thumbnailPaths, thumbnailWidth, thumbnailHeight
+}
+
+// findThumbnails returns the URLs of the thumbnails of the game in state that
+// exist in the folders in kinds. Games of an agent are looked up in the
+// thumbnails it sent first.
+func (s *Server) findThumbnails(cfg config.Config, state tracker.State, kinds []string) []string {
+	var urls []string
+	fsys := s.tracker.FS()
+	if state.Agent != "" {
+		// агент называет файлы по показанному имени игры
+		query := retroarch.ThumbnailQuery{System: state.System, Game: state.Game}
+		for _, path := range retroarch.FindThumbnails(fsys, s.agentThumbnailsDir(), query, kinds) {
+			urls = append(urls, "/agent-thumbnails/"+escapePath(path))
+		}
+	}
+	if len(urls) == 0 && cfg.ThumbnailsPath != "" {
+		query := retroarch.QueryFromHistory(fsys, cfg.RetroarchPath, state.System, state.Game)
+		for _, path := range retroarch.FindThumbnails(fsys, cfg.ThumbnailsPath, query, kinds) {
+			urls = append(urls, "/thumbnails/"+escapePath(path))
+		}
+	}
+	return urls
+}
+
+// escapePath escapes each element of a slash-separated path for a URL, so
+// names with # or % still load.
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func parseSizeToInt(sizeStr string) (int, int) {
+	sizeStr = strings.TrimSpace(sizeStr)
+	if sizeStr == "0" || sizeStr == "" {
+		return 0, 0
+	}
+
+	parts := strings.Split(sizeStr, "x")
+	if len(parts) != 2 {
+		return 0, 0
+	}
+
+	var width, height int
+
+	if parts[0] != "" {
+		if w, err := strconv.Atoi(parts[0]); err == nil {
+			width = w
+		}
+	}
+	if parts[1] != "" {
+		if h, err := strconv.Atoi(parts[1]); err == nil {
+			height = h
+		}
+	}
+
+	return width, height
+}
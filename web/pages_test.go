@@ -0,0 +1,82 @@
+package web
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"WatchdogRetroArch/tracker"
+)
+
+func TestParseSizeToInt(t *testing.T) {
+	tests := []struct {
+		size          string
+		width, height int
+	}{
+		{"", 0, 0},
+		{"0", 0, 0},
+		{" 320x240 ", 320, 240},
+		{"320x", 320, 0},
+		{"x240", 0, 240},
+		{"x", 0, 0},
+		{"320", 0, 0},
+		{"320x240x1", 0, 0},
+		{"abcx240", 0, 240},
+	}
+	for _, tt := range tests {
+		width, height := parseSizeToInt(tt.size)
+		if width != tt.width || height != tt.height {
+			t.Errorf("parseSizeToInt(%q) = %d, %d, want %d, %d", tt.size, width, height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestThumbnailPaths(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	thumbnails := ts.tracker.Config().ThumbnailsPath
+	for _, rel := range []string{
+		"Windows/Named_Titles/Doom.png",
+		"Windows/Named_Boxarts/Doom.png",
+		"Windows/Named_Titles/Game #1 100%.png",
+	} {
+		path := filepath.Join(thumbnails, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, testPNG(t), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kinds := []string{"Named_Titles", "Named_Boxarts"}
+
+	tests := []struct {
+		name          string
+		game          string
+		enabled       bool
+		size          string
+		want          []string
+		width, height string
+	}{
+		{"both kinds", "Doom", true, "", []string{"/thumbnails/Windows/Named_Titles/Doom.png", "/thumbnails/Windows/Named_Boxarts/Doom.png"}, "", ""},
+		{"escaped name", "Game #1 100%", true, "", []string{"/thumbnails/Windows/Named_Titles/Game%20%231%20100%25.png"}, "", ""},
+		{"no image", "Quake", true, "", []string{"/theme/default/noimage.png"}, "", ""},
+		{"thumbnails off", "Doom", false, "", nil, "", ""},
+		{"size", "Doom", true, "320x", []string{"/thumbnails/Windows/Named_Titles/Doom.png", "/thumbnails/Windows/Named_Boxarts/Doom.png"}, "320px", ""},
+		{"height only", "Doom", true, "x240", []string{"/thumbnails/Windows/Named_Titles/Doom.png", "/thumbnails/Windows/Named_Boxarts/Doom.png"}, "", "240px"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ts.tracker.Config()
+			cfg.EnableThumbnails = tt.enabled
+			cfg.ThumbnailSize = tt.size
+			paths, width, height := ts.thumbnailPaths(cfg, tracker.State{System: "Windows", Game: tt.game}, kinds)
+			if !slices.Equal(paths, tt.want) {
+				t.Errorf("paths = %q, want %q", paths, tt.want)
+			}
+			if width != tt.width || height != tt.height {
+				t.Errorf("size = %q x %q, want %q x %q", width, height, tt.width, tt.height)
+			}
+		})
+	}
+}
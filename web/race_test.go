@@ -0,0 +1,291 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/detection"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/templates"
+
+	"github.com/gorilla/websocket"
+)
+
+// loopSource plays its steps over and over and wakes the detector after
+// every one, so it ticks as fast as it can.
+type loopSource struct {
+	steps   []detection.Tick
+	next    int
+	current detection.Tick
+	changes chan detection.ProcessEvent
+}
+
+func (s *loopSource) Running() map[string]int32 {
+	s.current = s.steps[s.next%len(s.steps)]
+	s.next++
+	select {
+	case s.changes <- detection.ProcessEvent{}:
+	default:
+	}
+	return s.current.Processes
+}
+
+func (s *loopSource) Changes() <-chan detection.ProcessEvent { return s.changes }
+func (s *loopSource) ForegroundPID() (int32, error)          { return s.current.ForegroundPID, nil }
+
+func (s *loopSource) WindowTitle(pid int32) (string, error) {
+	return s.current.WindowTitles[pid], nil
+}
+
+func (s *loopSource) History(string) (string, string, error) {
+	if s.current.History == nil {
+		return "", "", errors.New("no content history on this step")
+	}
+	return s.current.History.Game, s.current.History.System, nil
+}
+
+// postSettings sends form to the settings page like ts.post, but reports
+// failures with t.Error, so it can run on its own goroutine.
+func (ts *testServer) postSettings(t *testing.T, form url.Values) {
+	req, err := http.NewRequest("POST", ts.http.URL+"/settings", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrfHeader, csrfTestToken)
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: csrfTestToken})
+	client := ts.http.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("settings saved with status %d", resp.StatusCode)
+	}
+}
+
+// TestConcurrentClients runs WebSocket clients, detection ticks and settings
+// saves at the same time. It finds most with go test -race.
+func TestConcurrentClients(t *testing.T) {
+	const (
+		clients = 6
+		rounds  = 20
+	)
+	ts := newTestServer(t, testConfig(t))
+	err := ts.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		return append(list,
+			templates.Template{ID: templates.NewID(), ProcessName: "Doom.exe", System: "Windows", Game: "Doom"},
+			templates.Template{ID: templates.NewID(), ProcessName: "Quake.exe", System: "Windows", Game: "Quake", Priority: 5},
+		), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conns []*wsClient
+	for i := range clients {
+		c := ts.dial(t, nil)
+		if i%2 == 0 {
+			c.register(t, "game", "")
+		} else {
+			c.register(t, "settings-games", "")
+		}
+		conns = append(conns, c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &loopSource{changes: make(chan detection.ProcessEvent, 1), steps: []detection.Tick{
+		{Processes: map[string]int32{"retroarch.exe": 10}, ForegroundPID: 10,
+			History: &detection.HistoryHead{Game: "Super Mario World", System: "Nintendo - Super Nintendo Entertainment System"}},
+		{Processes: map[string]int32{"retroarch.exe": 10, "doom.exe": 20}, ForegroundPID: 20, WindowTitles: map[int32]string{20: "Doom"}},
+		{Processes: map[string]int32{"doom.exe": 20, "quake.exe": 30}, ForegroundPID: 30, WindowTitles: map[int32]string{30: "Quake"}},
+		{Processes: map[string]int32{}},
+	}}
+	detected := make(chan struct{})
+	go func() {
+		detection.NewDetector(ts.tracker, src, detection.SystemClock{}, metrics.New()).Run(ctx)
+		close(detected)
+	}()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				if err := c.conn.WriteJSON(map[string]any{"type": "get_data", "dataType": "gameTemplates"}); err != nil {
+					t.Error(err)
+					return
+				}
+				// ответ приходит вперемешку с обновлениями от детектора
+				for answered := false; !answered; {
+					select {
+					case msg, ok := <-c.messages:
+						if !ok {
+							t.Error("connection closed")
+							return
+						}
+						answered = msg.Type == "gameTemplates"
+					case <-time.After(wsTimeout):
+						t.Error("no answer to get_data")
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		policies := []string{config.PolicyForeground, config.PolicyPriority, config.PolicySticky}
+		for i := range rounds {
+			ts.postSettings(t, url.Values{
+				"conflict_policy":           {policies[i%len(policies)]},
+				"thumbnail_switch_interval": {[]string{"5", "7"}[i%2]},
+			})
+		}
+	}()
+	wg.Wait()
+	cancel()
+	<-detected
+
+	// после всего клиенты по-прежнему получают обновления
+	ts.tracker.SetGame("Windows", "Final")
+	for i, c := range conns {
+		if i%2 == 0 {
+			for msg := c.waitFor(t, "update", "game"); !strings.Contains(string(msg.Payload), "Final"); {
+				msg = c.waitFor(t, "update", "game")
+			}
+		}
+	}
+	ts.savedMu.Lock()
+	defer ts.savedMu.Unlock()
+	if len(ts.saved) != rounds {
+		t.Errorf("%d settings saves, want %d", len(ts.saved), rounds)
+	}
+	if got := ts.tracker.Config().ThumbnailSwitchInterval; got != 7 {
+		t.Errorf("thumbnail_switch_interval = %d after the last save, want 7", got)
+	}
+}
+
+// hubServer accepts WebSocket connections into h without reading from them,
+// so only broadcasts notice a connection that went away.
+func hubServer(t *testing.T, h *hub) (dial func() (client, server *websocket.Conn)) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		h.add(conn)
+		h.register(conn, "game", "")
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+	return func() (*websocket.Conn, *websocket.Conn) {
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		t.Cleanup(func() { conn.Close() })
+		return conn, <-accepted
+	}
+}
+
+func TestBroadcastDropsClosedClient(t *testing.T) {
+	h := newHub()
+	dial := hubServer(t, h)
+	alive, _ := dial()
+	gone, goneServer := dial()
+	// сброс вместо закрытия: следующая запись на сервере сразу падает
+	gone.UnderlyingConn().(*net.TCPConn).SetLinger(0)
+	gone.Close()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deadline := time.Now().Add(wsTimeout)
+			for time.Now().Before(deadline) {
+				h.broadcast("game", "", `{"type":"update","screen":"game"}`)
+				h.mu.Lock()
+				_, ok := h.clients[goneServer]
+				h.mu.Unlock()
+				if !ok {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := h.screens()["game"]; got != 1 {
+		t.Fatalf("%d game clients left, want 1", got)
+	}
+	if err := goneServer.UnderlyingConn().Close(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("connection of the dropped client is still open: closing it again returned %v", err)
+	}
+	alive.SetReadDeadline(time.Now().Add(wsTimeout))
+	if _, _, err := alive.ReadMessage(); err != nil {
+		t.Errorf("remaining client got no broadcast: %v", err)
+	}
+}
+
+// TestBroadcastSlowClient checks that a client stuck in a write holds up
+// neither the hub nor broadcasts to other screens.
+func TestBroadcastSlowClient(t *testing.T) {
+	h := newHub()
+	dial := hubServer(t, h)
+	_, slowServer := dial()
+	other, otherServer := dial()
+	h.register(otherServer, "settings-games", "")
+
+	h.mu.Lock()
+	slow := h.clients[slowServer]
+	h.mu.Unlock()
+	// запись медленному клиенту «висит», пока держим его writeMu
+	slow.writeMu.Lock()
+	stuck := make(chan struct{})
+	go func() {
+		h.broadcast("game", "", `{"type":"update","screen":"game"}`)
+		close(stuck)
+	}()
+	// даём broadcast дойти до записи; если он держит блокировку хаба, дальше всё встанет
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		h.screens()
+		h.broadcast("settings-games", "", `{"type":"refresh","screen":"settings-games"}`)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wsTimeout):
+		t.Fatal("hub blocked by a client stuck in a write")
+	}
+	other.SetReadDeadline(time.Now().Add(wsTimeout))
+	if _, _, err := other.ReadMessage(); err != nil {
+		t.Errorf("other screen got no broadcast: %v", err)
+	}
+
+	slow.writeMu.Unlock()
+	<-stuck
+}
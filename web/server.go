@@ -0,0 +1,303 @@
+// Package web serves the widgets, the settings pages, the REST API and the
+// WebSocket that pushes updates to open pages.
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/agent"
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/gorilla/websocket"
+)
+
+// Dirs are the resource folders resolved at startup.
+type Dirs struct {
+	Theme   string
+	Lang    string
+	Systems string
+	// Save is save_path with the default applied.
+	Save string
+}
+
+// Options configure a Server.
+type Options struct {
+	Tracker *tracker.Tracker
+	Metrics *metrics.Metrics
+	Dirs    Dirs
+	Version string
+	// SaveConfig writes settings changed on the settings page to config.ini.
+	SaveConfig func(config.Config) error
+}
+
+// Server is the web interface of one tracker.
+type Server struct {
+	tracker    *tracker.Tracker
+	metrics    *metrics.Metrics
+	dirs       Dirs
+	version    string
+	saveConfig func(config.Config) error
+	hub        *hub
+	http       *http.Server
+	redirect   *http.Server
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+
+	// agentConns are the connected agents by slot, "" is the default slot
+	agentMu    sync.Mutex
+	agentConns map[string]*websocket.Conn
+}
+
+// New returns a server for opts.Tracker with the theme of its settings loaded.
+func New(opts Options) (*Server, error) {
+	s := &Server{
+		tracker:    opts.Tracker,
+		metrics:    opts.Metrics,
+		dirs:       opts.Dirs,
+		version:    opts.Version,
+		saveConfig: opts.SaveConfig,
+		hub:        newHub(),
+		agentConns: make(map[string]*websocket.Conn),
+	}
+	if err := s.LoadTheme(s.tracker.Config().Theme); err != nil {
+		return nil, err
+	}
+	s.tracker.Subscribe("web", s.handleEvent)
+	return s, nil
+}
+
+// ThemeFiles are the pages every theme provides (or inherits from default).
+var ThemeFiles = []string{
+	"index.html",
+	"game.html",
+	"system.html",
+	"all.html",
+	"settings.html",
+	"thumbnails.html",
+	"settings-games.html",
+	"diagnostics.html",
+	"logs.html",
+}
+
+// templateFuncs are available in every theme template.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// LoadTheme parses theme and uses it for every page from now on.
+func (s *Server) LoadTheme(theme string) error {
+	loaded, err := ParseTheme(s.dirs.Theme, theme)
+	if err != nil {
+		return err
+	}
+	s.SetTheme(loaded)
+	return nil
+}
+
+// SetTheme swaps in pages parsed by ParseTheme.
+func (s *Server) SetTheme(pages map[string]*template.Template) {
+	s.mu.Lock()
+	s.pages = pages
+	s.mu.Unlock()
+}
+
+// ParseTheme parses every page of a theme in themeDir, taking missing files
+// from the default theme. Nothing is returned if any template fails to parse.
+func ParseTheme(themeDir, theme string) (map[string]*template.Template, error) {
+	loaded := make(map[string]*template.Template)
+	dir := filepath.Join(themeDir, theme)
+	defaultDir := filepath.Join(themeDir, "default")
+
+	for _, file := range ThemeFiles {
+		tmplPath := filepath.Join(dir, file)
+		source := theme
+
+		if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+			tmplPath = filepath.Join(defaultDir, file)
+			if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+				return nil, fmt.Errorf("template %s not found in theme %s or default theme", file, theme)
+			}
+			source = "default"
+		}
+		tmpl, err := template.New(file).Funcs(templateFuncs).ParseFiles(tmplPath)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %v", tmplPath, err)
+		}
+		slog.Debug("Loaded template", "file", file, "theme", source)
+
+		loaded[file] = tmpl
+	}
+	return loaded, nil
+}
+
+// availableThemes lists the theme folders in dir.
+func availableThemes(dir string) []string {
+	var themes []string
+	dirs, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error("Error reading Theme folder", "err", err)
+		return []string{"default"}
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			themes = append(themes, d.Name())
+		}
+	}
+	if len(themes) == 0 {
+		return []string{"default"}
+	}
+	return themes
+}
+
+func (s *Server) translations(w http.ResponseWriter, language string) (i18n.Translations, bool) {
+	translations, _, err := i18n.Load(s.dirs.Lang, language)
+	if err != nil {
+		slog.Error("Error loading translations", "err", err)
+		http.Error(w, "Server error: failed to load translations", http.StatusInternalServerError)
+		return nil, false
+	}
+	return translations, true
+}
+
+func (s *Server) render(w http.ResponseWriter, tmplName string, data interface{}) {
+	s.mu.RLock()
+	tmpl, ok := s.pages[tmplName]
+	s.mu.RUnlock()
+	if !ok {
+		slog.Error("Template not found", "template", tmplName)
+		http.Error(w, fmt.Sprintf("Server error: template %s not found", tmplName), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := tmpl.Execute(w, data)
+	if err != nil {
+		slog.Error("Error rendering template", "template", tmplName, "err", err)
+		http.Error(w, "Server error: failed to render template", http.StatusInternalServerError)
+		return
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding API response", "err", err)
+	}
+}
+
+// Handler returns every page, the API and the WebSocket endpoint, so the
+// server can also be driven without listening on a port.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/systems/", http.StripPrefix("/systems/", http.FileServer(http.Dir(s.dirs.Systems))))
+	mux.Handle("/theme/", http.StripPrefix("/theme/", http.FileServer(http.Dir(s.dirs.Theme))))
+	mux.Handle("/thumbnails/", http.StripPrefix("/thumbnails/", http.HandlerFunc(s.handleThumbnailFile)))
+	mux.Handle("/agent-thumbnails/", http.StripPrefix("/agent-thumbnails/", http.FileServer(http.Dir(s.agentThumbnailsDir()))))
+
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/game", s.handleGame)
+	mux.HandleFunc("/system", s.handleSystem)
+	mux.HandleFunc("/all", s.handleAll)
+	mux.HandleFunc("/thumbnails", s.handleThumbnails)
+	mux.HandleFunc("/settings", s.requireAdmin(requireCSRF(maxFormSize, s.handleSettings)))
+	mux.HandleFunc("/settings-games", s.requireAdmin(requireCSRF(maxThumbnailFormSize, s.handleSettingsGames)))
+	mux.HandleFunc("/settings-games/templates", s.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(s.tracker.Templates())
+		if err != nil {
+			slog.Error("Error encoding game templates", "err", err)
+			http.Error(w, "Server error: failed to encode templates", http.StatusInternalServerError)
+		}
+	}))
+	mux.HandleFunc("/logs", s.requireAdmin(s.handleLogs))
+	mux.HandleFunc("/diagnostics", s.requireAdmin(s.handleDiagnostics))
+	mux.HandleFunc("/login", requireCSRF(maxFormSize, s.handleLogin))
+	mux.HandleFunc("/logout", s.handleLogout)
+	mux.HandleFunc("/startport", s.handleWebSocket)
+	mux.HandleFunc(agent.Path, s.handleAgent)
+	s.registerTemplateAPI(mux)
+	s.registerMetrics(mux)
+	return mux
+}
+
+// Start starts serving on bind_address and web_port in the background, over
+// HTTPS when it is enabled.
+func (s *Server) Start() {
+	cfg := s.tracker.Config()
+	s.http = &http.Server{
+		Addr:              config.ListenAddr(cfg),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.HTTPS {
+		cert, err := LoadCertificate(cfg, s.tracker.SavePath())
+		if err != nil {
+			// без сертификата лучше работать по HTTP, чем не работать совсем
+			slog.Error("HTTPS is not available, serving plain HTTP", "err", err)
+			cfg.HTTPS = false
+		} else {
+			s.http.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		}
+	}
+	slog.Info("Web server started", "url", config.LocalURL(cfg), "addr", config.ListenAddr(cfg))
+	go func() {
+		var err error
+		if s.http.TLSConfig != nil {
+			err = s.http.ListenAndServeTLS("", "")
+		} else {
+			err = s.http.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Web server error", "err", err)
+		}
+	}()
+
+	if cfg.HTTPS && cfg.HTTPRedirectPort != 0 {
+		s.redirect = &http.Server{
+			Addr:              net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.HTTPRedirectPort)),
+			Handler:           redirectToHTTPS(cfg.WebPort),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		slog.Info("Redirecting HTTP to HTTPS", "addr", s.redirect.Addr)
+		go func() {
+			if err := s.redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP redirect server error", "err", err)
+			}
+		}()
+	}
+}
+
+// Shutdown says goodbye to every widget and stops the server, waiting for
+// open requests until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.hub.closeAll()
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			slog.Warn("Error stopping HTTP redirect server", "err", err)
+		}
+	}
+	if s.http == nil {
+		return nil
+	}
+	return s.http.Shutdown(ctx)
+}
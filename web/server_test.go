@@ -0,0 +1,154 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/internal/fsutil"
+	"WatchdogRetroArch/metrics"
+	"WatchdogRetroArch/tracker"
+)
+
+// testServer is a Server on an httptest server with the repository's theme
+// and translations, saving into temporary folders.
+type testServer struct {
+	*Server
+	tracker *tracker.Tracker
+	http    *httptest.Server
+	savedMu sync.Mutex
+	saved   []config.Config
+	saveErr error // returned by SaveConfig instead of saving
+}
+
+func testConfig(t *testing.T) config.Config {
+	return config.Config{
+		RetroarchPath:           t.TempDir(),
+		WebPort:                 3489,
+		BindAddress:             config.DefaultBindAddress,
+		Theme:                   "default",
+		Language:                "en",
+		ThumbnailsPath:          t.TempDir(),
+		EnableThumbnails:        true,
+		ThumbnailTypes:          config.DefaultThumbnailTypes,
+		ThumbnailSwitchInterval: 5,
+		FadeDuration:            0.5,
+		FadeType:                "ease-out",
+		ConflictPolicy:          config.PolicyForeground,
+		LogLevel:                "info",
+		LogFormat:               config.LogFormatText,
+		Systems:                 map[string]string{},
+	}
+}
+
+func newTestServer(t *testing.T, cfg config.Config) *testServer {
+	t.Helper()
+	save := t.TempDir()
+	tr := tracker.New(cfg, save, fsutil.OS)
+	if err := tr.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{tracker: tr}
+	srv, err := New(Options{
+		Tracker: tr,
+		Metrics: metrics.New(),
+		Dirs:    Dirs{Theme: "../Theme", Lang: "../lang", Systems: "../systems", Save: save},
+		Version: "test",
+		SaveConfig: func(cfg config.Config) error {
+			ts.savedMu.Lock()
+			defer ts.savedMu.Unlock()
+			if ts.saveErr != nil {
+				return ts.saveErr
+			}
+			ts.saved = append(ts.saved, cfg)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Server = srv
+	ts.http = httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+		ts.http.Close()
+		tr.Close()
+	})
+	return ts
+}
+
+func (ts *testServer) do(t *testing.T, method, path, contentType string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.http.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := ts.http.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// testPNG returns a small valid PNG image.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnailFileFollowsConfig(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	cfg := ts.tracker.Config()
+	moved := t.TempDir()
+	for dir, content := range map[string]string{cfg.ThumbnailsPath: "old", moved: "new"} {
+		if err := os.MkdirAll(filepath.Join(dir, "Windows", "Named_Titles"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "Windows", "Named_Titles", "Game.png"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		thumbnails string
+		status     int
+		body       string
+	}{
+		{"startup folder", cfg.ThumbnailsPath, http.StatusOK, "old"},
+		{"changed folder", moved, http.StatusOK, "new"},
+		{"no folder", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := cfg
+			next.ThumbnailsPath = tt.thumbnails
+			ts.tracker.SetConfig(next)
+			resp := ts.do(t, "GET", "/thumbnails/Windows/Named_Titles/Game.png", "", nil)
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
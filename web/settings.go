@@ -0,0 +1,463 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"WatchdogRetroArch/agent"
+	"WatchdogRetroArch/config"
+	"WatchdogRetroArch/i18n"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+)
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	currentConfig := s.tracker.Config()
+	if r.Method == "GET" {
+		s.renderSettings(w, r, currentConfig, nil)
+	} else if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		translations, ok := s.translations(w, currentConfig.Language)
+		if !ok {
+			return
+		}
+		cfg, fieldErrors := readSettingsForm(s.dirs, r.PostForm, currentConfig, translations)
+		// тему только разбираем: применяем её после успешной записи config.ini
+		var theme map[string]*template.Template
+		if len(fieldErrors) == 0 && cfg.Theme != currentConfig.Theme {
+			var err error
+			if theme, err = ParseTheme(s.dirs.Theme, cfg.Theme); err != nil {
+				slog.Error("Error loading theme", "theme", cfg.Theme, "err", err)
+				fieldErrors["theme"] = translations["error_theme_broken"]
+			}
+		}
+		if len(fieldErrors) > 0 {
+			slog.Info("Settings not saved", "errors", fieldErrors)
+			s.renderSettings(w, r, cfg, fieldErrors)
+			return
+		}
+		if err := s.saveConfig(cfg); err != nil {
+			http.Error(w, "Error saving settings", http.StatusInternalServerError)
+			slog.Error("Error saving config.ini", "err", err)
+			return
+		}
+		if theme != nil {
+			s.SetTheme(theme)
+		}
+		if cfg.AdminToken != currentConfig.AdminToken {
+			// браузер, сменивший токен, остаётся администратором
+			setAdminCookie(w, r, cfg.AdminToken)
+		}
+		s.tracker.SetConfig(cfg)
+		slog.Info("Settings updated")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	}
+}
+
+// renderSettings shows the settings page for cfg. With fieldErrors the page
+// is answered with 422 and every message is shown next to its field.
+func (s *Server) renderSettings(w http.ResponseWriter, r *http.Request, cfg config.Config, fieldErrors map[string]string) {
+	translations, ok := s.translations(w, cfg.Language)
+	if !ok {
+		return
+	}
+	data := struct {
+		Config           config.Config
+		Themes           []string
+		Languages        []i18n.Language
+		ConflictPolicies []string
+		Errors           map[string]string
+		CSRF             string
+		T                i18n.Translations
+	}{
+		Config:           cfg,
+		Themes:           availableThemes(s.dirs.Theme),
+		Languages:        i18n.Available(s.dirs.Lang),
+		ConflictPolicies: config.ConflictPolicies,
+		Errors:           fieldErrors,
+		CSRF:             csrfToken(w, r),
+		T:                translations,
+	}
+	if len(fieldErrors) > 0 {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	s.render(w, "settings.html", data)
+}
+
+// ApplySettings checks config.ini values with the rules of the settings page
+// and returns cfg with them applied, or an English message per invalid key.
+// Values use the config.ini syntax, e.g. true and false for checkboxes, and
+// are checked together like the fields of one submitted form.
+func ApplySettings(dirs Dirs, cfg config.Config, values map[string]string) (config.Config, map[string]string, error) {
+	t, _, err := i18n.Load(dirs.Lang, "en")
+	if err != nil {
+		return cfg, nil, err
+	}
+	form := make(url.Values)
+	fieldErrors := make(map[string]string)
+	for key, value := range values {
+		if !config.IsBoolKey(key) {
+			form.Set(key, value)
+			continue
+		}
+		on, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			fieldErrors[key] = t["error_invalid_value"]
+			continue
+		}
+		form.Set(key, map[bool]string{true: "on", false: "off"}[on])
+	}
+	next, formErrors := readSettingsForm(dirs, form, cfg, t)
+	maps.Copy(fieldErrors, formErrors)
+	// на странице пустой токен оставляет прежний, а здесь его можно стереть
+	if token, ok := values["admin_token"]; ok {
+		next.AdminToken = strings.TrimSpace(token)
+	}
+	if token, ok := values["agent_token"]; ok {
+		next.AgentToken = strings.TrimSpace(token)
+	}
+	return next, fieldErrors, nil
+}
+
+// readSettingsForm applies a submitted settings form to cfg. Fields missing
+// from the form keep their value, so a page that only shows some of them
+// cannot blank the rest. Unchecked checkboxes are sent as "off" by a hidden
+// input in front of them.
+func readSettingsForm(dirs Dirs, form url.Values, cfg config.Config, t i18n.Translations) (config.Config, map[string]string) {
+	f := settingsForm{values: form, errors: make(map[string]string), t: t}
+
+	f.folder("retroarch_path", &cfg.RetroarchPath, true)
+	f.path("save_path", &cfg.SavePath)
+	f.folder("thumbnails_path", &cfg.ThumbnailsPath, false)
+	f.checkbox("save_to_one_file", &cfg.SaveToOneFile)
+	f.checkbox("autorun", &cfg.Autorun)
+	f.checkbox("output_to_files", &cfg.OutputToFiles)
+	f.checkbox("clear_output_on_exit", &cfg.ClearOutputOnExit)
+	f.checkbox("enable_thumbnails", &cfg.EnableThumbnails)
+	f.checkbox("alternate_thumbnails", &cfg.AlternateThumbnails)
+	f.checkbox("exclude_system_dirs", &cfg.ExcludeSystemDirs)
+	f.checkbox("https", &cfg.HTTPS)
+	f.file("tls_cert_file", &cfg.TLSCertFile)
+	f.file("tls_key_file", &cfg.TLSKeyFile)
+	f.file("agent_ca_file", &cfg.AgentCAFile)
+	f.number("web_port", &cfg.WebPort, 1, 65535)
+	f.number("system_icon", &cfg.SystemIcon, 0, 2)
+	f.number("http_redirect_port", &cfg.HTTPRedirectPort, 0, 65535)
+	f.number("thumbnail_switch_interval", &cfg.ThumbnailSwitchInterval, 1, math.MaxInt32)
+	f.number("log_max_size_mb", &cfg.LogMaxSizeMB, 0, math.MaxInt32)
+	f.number("log_max_age_days", &cfg.LogMaxAgeDays, 0, math.MaxInt32)
+	f.list("excluded_users", &cfg.ExcludedUsers)
+	f.list("excluded_processes", &cfg.ExcludedProcesses)
+	f.list("excluded_paths", &cfg.ExcludedPaths)
+
+	f.choice("bind_address", &cfg.BindAddress, func(v string) bool {
+		return v == "localhost" || net.ParseIP(v) != nil
+	})
+	f.choice("agent_url", &cfg.AgentURL, func(v string) bool {
+		return v == "" || agent.ValidURL(v)
+	})
+	f.choice("agent_slot", &cfg.AgentSlot, func(v string) bool {
+		return v == "" || tracker.ValidSlotName(v)
+	})
+	f.choice("thumbnail_size", &cfg.ThumbnailSize, func(v string) bool {
+		return v == "" || thumbnailSizePattern.MatchString(v)
+	})
+	f.choice("fade_type", &cfg.FadeType, func(v string) bool {
+		return slices.Contains(config.FadeTypes, v)
+	})
+	f.choice("conflict_policy", &cfg.ConflictPolicy, config.IsValidConflictPolicy)
+	f.choice("log_level", &cfg.LogLevel, config.ValidLogLevel)
+	f.choice("log_format", &cfg.LogFormat, func(v string) bool {
+		return v == config.LogFormatText || v == config.LogFormatJSON
+	})
+	f.choice("theme", &cfg.Theme, func(v string) bool {
+		return slices.Contains(availableThemes(dirs.Theme), v)
+	})
+	f.choice("language", &cfg.Language, func(v string) bool {
+		for _, lang := range i18n.Available(dirs.Lang) {
+			if lang.Code == v {
+				return true
+			}
+		}
+		return false
+	})
+
+	if v, ok := f.value("fade_duration"); ok {
+		duration, err := strconv.ParseFloat(strings.Replace(v, ",", ".", -1), 64)
+		if err != nil || duration < 0.1 {
+			f.fail("fade_duration", "error_fade_duration")
+		} else {
+			cfg.FadeDuration = duration
+		}
+	}
+	if v, ok := f.value("thumbnail_types"); ok {
+		var types []string
+		for _, t := range config.SplitList(strings.ToLower(v)) {
+			if _, known := retroarch.ThumbnailFolder(t); !known {
+				f.fail("thumbnail_types", "error_thumbnail_types")
+			} else if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+		if len(types) == 0 {
+			types = config.DefaultThumbnailTypes
+		}
+		cfg.ThumbnailTypes = types
+	}
+	if _, ok := f.errors["http_redirect_port"]; !ok && cfg.HTTPRedirectPort != 0 && cfg.HTTPRedirectPort == cfg.WebPort {
+		f.fail("http_redirect_port", "error_same_port")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		f.fail("tls_key_file", "error_tls_pair")
+	}
+	// пустое поле оставляет прежний токен, чтобы он не попадал в страницу
+	if token := form.Get("admin_token"); token != "" {
+		cfg.AdminToken = token
+	}
+	if token := form.Get("agent_token"); token != "" {
+		cfg.AgentToken = token
+	}
+	cfg.AgentURL = strings.TrimRight(cfg.AgentURL, "/")
+	return cfg, f.errors
+}
+
+// settingsForm reads fields of the settings form and collects a translated
+// message for every field that is not valid.
+type settingsForm struct {
+	values url.Values
+	errors map[string]string
+	t      i18n.Translations
+}
+
+// value returns the last value sent for key, which is the checkbox itself
+// when both it and its hidden "off" are sent.
+func (f *settingsForm) value(key string) (string, bool) {
+	values := f.values[key]
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(values[len(values)-1]), true
+}
+
+func (f *settingsForm) fail(key, message string) {
+	f.errors[key] = f.t[message]
+}
+
+func (f *settingsForm) checkbox(key string, dst *bool) {
+	if v, ok := f.value(key); ok {
+		*dst = v == "on"
+	}
+}
+
+func (f *settingsForm) number(key string, dst *int, min, max int) {
+	v, ok := f.value(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		if max == math.MaxInt32 {
+			f.errors[key] = fmt.Sprintf(f.t["error_number_min"], min)
+		} else {
+			f.errors[key] = fmt.Sprintf(f.t["error_number_range"], min, max)
+		}
+		return
+	}
+	*dst = n
+}
+
+func (f *settingsForm) list(key string, dst *[]string) {
+	if v, ok := f.value(key); ok {
+		*dst = config.SplitList(v)
+	}
+}
+
+func (f *settingsForm) choice(key string, dst *string, valid func(string) bool) {
+	v, ok := f.value(key)
+	if !ok {
+		return
+	}
+	if !valid(v) {
+		f.fail(key, "error_invalid_value")
+		return
+	}
+	*dst = v
+}
+
+// path reads a folder setting that the program creates itself. Empty means
+// the default folder next to config.ini.
+func (f *settingsForm) path(key string, dst *string) {
+	v, ok := f.value(key)
+	if !ok {
+		return
+	}
+	if v != "" {
+		v = config.CleanPath(v)
+	}
+	*dst = v
+}
+
+// file reads an optional setting naming a file that must exist.
+func (f *settingsForm) file(key string, dst *string) {
+	v, ok := f.value(key)
+	if !ok {
+		return
+	}
+	v = config.CleanPath(v)
+	if v != "" {
+		if info, err := os.Stat(v); err != nil || info.IsDir() {
+			f.fail(key, "error_file_not_found")
+			return
+		}
+	}
+	*dst = v
+}
+
+// folder reads a folder setting that must already exist. An unchanged
+// folder is not checked again, so a missing drive does not block saving the
+// other settings.
+func (f *settingsForm) folder(key string, dst *string, required bool) {
+	v, ok := f.value(key)
+	if !ok {
+		return
+	}
+	if v == "" {
+		if required {
+			f.fail(key, "error_required")
+		} else {
+			*dst = ""
+		}
+		return
+	}
+	v = config.CleanPath(v)
+	if v == *dst {
+		return
+	}
+	if info, err := os.Stat(v); err != nil || !info.IsDir() {
+		f.fail(key, "error_folder_not_found")
+		return
+	}
+	*dst = v
+}
+
+func (s *Server) handleSettingsGames(w http.ResponseWriter, r *http.Request) {
+	currentConfig := s.tracker.Config()
+
+	slog.Debug("Handling /settings-games", "method", r.Method)
+
+	if r.Method == "GET" {
+		translations, ok := s.translations(w, currentConfig.Language)
+		if !ok {
+			return
+		}
+		data := struct {
+			Config        config.Config
+			GameTemplates []templates.Template
+			CSRF          string
+			T             i18n.Translations
+			Port          int
+		}{
+			Config:        currentConfig,
+			GameTemplates: s.tracker.Templates(),
+			CSRF:          csrfToken(w, r),
+			T:             translations,
+			Port:          currentConfig.WebPort,
+		}
+		slog.Debug("Rendering settings-games.html")
+		s.render(w, "settings-games.html", data)
+	} else if r.Method == "POST" {
+		// requireCSRF уже ограничил и разобрал тело, здесь только проверяем, что это multipart
+		if err := r.ParseMultipartForm(maxThumbnailFormSize); err != nil {
+			slog.Error("Error parsing form", "err", err)
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+
+		processName := r.FormValue("process_name_display")
+		windowTitle := r.FormValue("window_title")
+		priority, _ := strconv.Atoi(r.FormValue("priority"))
+
+		system := "Windows"
+		game := strings.TrimSuffix(processName, ".exe")
+		if processName == "retroarch.exe" {
+			state := s.tracker.State()
+			system = state.System
+			game = state.Game
+		}
+
+		tmpl := templates.Template{
+			ID:          templates.NewID(),
+			ProcessName: processName,
+			WindowTitle: windowTitle,
+			System:      system,
+			Game:        game,
+			Priority:    priority,
+		}
+		// проверяем до записи картинок, чтобы отклонённый шаблон не оставлял файлов
+		if fields := templates.Validate(&tmpl, s.tracker.Templates()); len(fields) > 0 {
+			slog.Warn("Template not saved", "process", processName, "errors", validationError(fields).describe())
+			http.Error(w, validationError(fields).describe(), http.StatusUnprocessableEntity)
+			return
+		}
+		tmpl.NamedTitles = saveFormThumbnail(r, "named_titles", currentConfig.ThumbnailsPath, tmpl.System, tmpl.Game)
+		tmpl.NamedBoxarts = saveFormThumbnail(r, "named_boxarts", currentConfig.ThumbnailsPath, tmpl.System, tmpl.Game)
+		err := s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+			if fields := templates.Validate(&tmpl, list); len(fields) > 0 {
+				return nil, validationError(fields)
+			}
+			return append(list, tmpl), nil
+		})
+		var fields validationError
+		if errors.As(err, &fields) {
+			http.Error(w, fields.describe(), http.StatusUnprocessableEntity)
+			return
+		} else if err != nil {
+			slog.Error("Error saving game templates", "err", err)
+		}
+
+		slog.Debug("Redirecting to /settings-games after POST")
+		http.Redirect(w, r, "/settings-games", http.StatusSeeOther)
+	}
+}
+
+// saveFormThumbnail stores the image uploaded in field as
+// <thumbnailsPath>/<system>/<kind>/<game>.png and returns its path relative to
+// thumbnailsPath, or "" if nothing was uploaded or the upload was rejected.
+func saveFormThumbnail(r *http.Request, field, thumbnailsPath, system, game string) string {
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Warn("failed close", "err", err)
+		}
+	}()
+	data, err := decodeThumbnail(file)
+	if err != nil {
+		slog.Warn("Rejected uploaded thumbnail", "field", field, "err", err)
+		return ""
+	}
+	rel, err := writeThumbnail(thumbnailsPath, system, field, game, data)
+	if err != nil {
+		slog.Error("Error saving "+field, "err", err)
+		return ""
+	}
+	return rel
+}
@@ -0,0 +1,280 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"WatchdogRetroArch/config"
+)
+
+// csrfTestToken is sent as cookie and header, like the pages do.
+const csrfTestToken = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func (ts *testServer) post(t *testing.T, path, contentType string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("POST", ts.http.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(csrfHeader, csrfTestToken)
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: csrfTestToken})
+	client := ts.http.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func multipartForm(t *testing.T, fields map[string]string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestSettingsGamesPost(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	tests := []struct {
+		name    string
+		process string
+		status  int
+		count   int
+	}{
+		{"valid", "Game.exe", http.StatusSeeOther, 2},
+		{"duplicate", "Game.exe", http.StatusUnprocessableEntity, 2},
+		{"path instead of name", `C:\Games\Game.exe`, http.StatusUnprocessableEntity, 2},
+		{"empty", "", http.StatusUnprocessableEntity, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body := multipartForm(t, map[string]string{"process_name_display": tt.process, "priority": "1"})
+			resp := ts.post(t, "/settings-games", contentType, body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %s, want %d", resp.Status, tt.status)
+			}
+			if got := len(ts.tracker.Templates()); got != tt.count {
+				t.Errorf("%d templates, want %d", got, tt.count)
+			}
+		})
+	}
+	for _, tmpl := range ts.tracker.Templates() {
+		if strings.Contains(tmpl.ProcessName, `\`) {
+			t.Errorf("invalid template saved: %+v", tmpl)
+		}
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	dirs := Dirs{Theme: "../Theme", Lang: "../lang"}
+	cfg := testConfig(t)
+	cfg.AdminToken = "secret"
+	tests := []struct {
+		name    string
+		values  map[string]string
+		invalid []string
+		check   func(t *testing.T, got config.Config)
+	}{
+		{"port", map[string]string{"web_port": "8080"}, nil, func(t *testing.T, got config.Config) {
+			if got.WebPort != 8080 {
+				t.Errorf("web_port = %d", got.WebPort)
+			}
+		}},
+		{"port not a number", map[string]string{"web_port": "abc"}, []string{"web_port"}, nil},
+		{"port out of range", map[string]string{"web_port": "70000"}, []string{"web_port"}, nil},
+		{"boolean", map[string]string{"https": "true", "autorun": "0"}, nil, func(t *testing.T, got config.Config) {
+			if !got.HTTPS || got.Autorun {
+				t.Errorf("https = %v, autorun = %v", got.HTTPS, got.Autorun)
+			}
+		}},
+		{"boolean not a boolean", map[string]string{"https": "maybe"}, []string{"https"}, nil},
+		{"unknown theme", map[string]string{"theme": "missing"}, []string{"theme"}, nil},
+		{"unknown language", map[string]string{"language": "xx"}, []string{"language"}, nil},
+		{"conflict policy", map[string]string{"conflict_policy": "random"}, []string{"conflict_policy"}, nil},
+		{"missing folder", map[string]string{"thumbnails_path": filepath.Join(t.TempDir(), "missing")}, []string{"thumbnails_path"}, nil},
+		{"redirect to the web port", map[string]string{"http_redirect_port": "3489"}, []string{"http_redirect_port"}, nil},
+		{"tls file alone", map[string]string{"tls_cert_file": "../README.md"}, []string{"tls_key_file"}, nil},
+		{"tls pair", map[string]string{"tls_cert_file": "../README.md", "tls_key_file": "../LICENSE"}, nil, nil},
+		{"token cleared", map[string]string{"admin_token": ""}, nil, func(t *testing.T, got config.Config) {
+			if got.AdminToken != "" {
+				t.Errorf("admin_token = %q, want it cleared", got.AdminToken)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fieldErrors, err := ApplySettings(dirs, cfg, tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := slices.Sorted(maps.Keys(fieldErrors)); !slices.Equal(keys, tt.invalid) {
+				t.Fatalf("invalid keys = %v, want %v (%v)", keys, tt.invalid, fieldErrors)
+			}
+			for key, msg := range fieldErrors {
+				if msg == "" {
+					t.Errorf("%s: empty message", key)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestSettingsPost(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		check  func(t *testing.T, saved config.Config)
+	}{
+		{
+			name:   "valid",
+			form:   url.Values{"web_port": {"8080"}, "fade_duration": {"1,5"}, "thumbnail_types": {"Boxart, logo, boxart"}, "https": {"off"}},
+			status: http.StatusSeeOther,
+			check: func(t *testing.T, saved config.Config) {
+				if saved.WebPort != 8080 || saved.FadeDuration != 1.5 {
+					t.Errorf("web_port = %d, fade_duration = %v", saved.WebPort, saved.FadeDuration)
+				}
+				if !slices.Equal(saved.ThumbnailTypes, []string{"boxart", "logo"}) {
+					t.Errorf("thumbnail_types = %v", saved.ThumbnailTypes)
+				}
+			},
+		},
+		{
+			name:   "missing fields keep their value",
+			form:   url.Values{"log_level": {"debug"}},
+			status: http.StatusSeeOther,
+			check: func(t *testing.T, saved config.Config) {
+				if saved.LogLevel != "debug" || saved.WebPort != 3489 || saved.Theme != "default" {
+					t.Errorf("saved = %+v", saved)
+				}
+			},
+		},
+		{
+			name:   "checkbox and hidden off",
+			form:   url.Values{"enable_thumbnails": {"off"}, "autorun": {"off", "on"}},
+			status: http.StatusSeeOther,
+			check: func(t *testing.T, saved config.Config) {
+				if saved.EnableThumbnails || !saved.Autorun {
+					t.Errorf("enable_thumbnails = %v, autorun = %v", saved.EnableThumbnails, saved.Autorun)
+				}
+			},
+		},
+		{"port not a number", url.Values{"web_port": {"abc"}}, http.StatusUnprocessableEntity, nil},
+		{"unknown theme", url.Values{"theme": {"../../etc"}}, http.StatusUnprocessableEntity, nil},
+		{"short fade", url.Values{"fade_duration": {"0.01"}}, http.StatusUnprocessableEntity, nil},
+		{"unknown thumbnail type", url.Values{"thumbnail_types": {"title,photo"}}, http.StatusUnprocessableEntity, nil},
+		{"bad agent url", url.Values{"agent_url": {"ftp://example.com"}}, http.StatusUnprocessableEntity, nil},
+		{"required folder", url.Values{"retroarch_path": {""}}, http.StatusUnprocessableEntity, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, testConfig(t))
+			before := ts.tracker.Config()
+			resp := ts.post(t, "/settings", "application/x-www-form-urlencoded", []byte(tt.form.Encode()))
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusSeeOther {
+				if len(ts.saved) > 0 {
+					t.Errorf("invalid settings were saved: %+v", ts.saved)
+				}
+				if !reflect.DeepEqual(ts.tracker.Config(), before) {
+					t.Error("invalid settings were applied")
+				}
+				return
+			}
+			if len(ts.saved) != 1 {
+				t.Fatalf("saved %d times, want once", len(ts.saved))
+			}
+			if !reflect.DeepEqual(ts.tracker.Config(), ts.saved[0]) {
+				t.Error("applied settings differ from the saved ones")
+			}
+			tt.check(t, ts.saved[0])
+		})
+	}
+}
+
+// TestSettingsPostDefaults sends back the form of a fresh install, where
+// save_path is empty and means the folder next to config.ini.
+func TestSettingsPostDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	cfg, _, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SavePath != "" {
+		t.Fatalf("default save_path = %q, want empty", cfg.SavePath)
+	}
+	ts := newTestServer(t, cfg)
+	form := make(url.Values)
+	for key, value := range config.Values(cfg) {
+		if config.IsBoolKey(key) {
+			value = map[bool]string{true: "on", false: "off"}[value == "true"]
+		}
+		form.Set(key, value)
+	}
+	resp := ts.post(t, "/settings", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	if len(ts.saved) != 1 || ts.saved[0].SavePath != "" {
+		t.Errorf("saved = %+v, want one save with an empty save_path", ts.saved)
+	}
+
+	// то же через config set
+	dirs := Dirs{Theme: "../Theme", Lang: "../lang"}
+	if _, fieldErrors, err := ApplySettings(dirs, cfg, map[string]string{"save_path": ""}); err != nil || len(fieldErrors) > 0 {
+		t.Errorf("ApplySettings(save_path=\"\") = %v, %v", fieldErrors, err)
+	}
+}
+
+func TestSettingsPostSaveFails(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	ts.saveErr = errors.New("disk full")
+	before := ts.tracker.Config()
+	ts.mu.RLock()
+	pages := ts.pages
+	ts.mu.RUnlock()
+
+	form := url.Values{"theme": {"Black"}, "admin_token": {"new-token"}}
+	resp := ts.post(t, "/settings", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == adminCookie {
+			t.Error("admin cookie set although the settings were not saved")
+		}
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if !maps.Equal(ts.pages, pages) {
+		t.Error("theme switched although the settings were not saved")
+	}
+	if !reflect.DeepEqual(ts.tracker.Config(), before) {
+		t.Error("settings applied although they were not saved")
+	}
+}
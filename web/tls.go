@@ -0,0 +1,132 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"WatchdogRetroArch/config"
+)
+
+const (
+	// selfSignedValidity is how long a generated certificate is valid.
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+	// renewBefore regenerates a certificate that is about to expire.
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// SelfSignedPaths returns where the generated certificate and key are kept.
+func SelfSignedPaths(savePath string) (certFile, keyFile string) {
+	dir := filepath.Join(savePath, "tls")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// LoadCertificate returns the certificate from tls_cert_file and
+// tls_key_file, or a self-signed one kept under savePath when they are not
+// set. The self-signed certificate is created on first use and renewed
+// before it expires.
+func LoadCertificate(cfg config.Config, savePath string) (tls.Certificate, error) {
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("error loading tls_cert_file/tls_key_file: %v", err)
+		}
+		return cert, nil
+	}
+
+	certFile, keyFile := SelfSignedPaths(savePath)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil && cert.Leaf != nil && time.Until(cert.Leaf.NotAfter) > renewBefore {
+		return cert, nil
+	}
+	if err == nil {
+		slog.Info("Renewing self-signed certificate", "path", certFile)
+	}
+	if err := generateSelfSigned(certFile, keyFile, cfg.BindAddress); err != nil {
+		return tls.Certificate{}, fmt.Errorf("error creating self-signed certificate: %v", err)
+	}
+	slog.Info("Created self-signed certificate", "path", certFile)
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// generateSelfSigned writes a certificate valid for localhost, the name of
+// this computer and its network addresses, so other devices on the network
+// can open the pages once they accept it.
+func generateSelfSigned(certFile, keyFile, bindAddress string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "TrackGameName", Organization: []string{"TrackGameName"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if ip := net.ParseIP(bindAddress); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	// ключ пишем первым и только для текущего пользователя
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same page on the HTTPS
+// port.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(httpsPort)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+	})
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"WatchdogRetroArch/retroarch"
+)
+
+const (
+	// maxUploadSize limits one uploaded thumbnail.
+	maxUploadSize = 5 << 20
+	// maxThumbnailSide limits the width and height of an uploaded image, so a
+	// small file cannot unpack into gigabytes of pixels.
+	maxThumbnailSide = 4096
+	// maxMessageSize fits a thumbnail encoded as a data URL into one
+	// WebSocket message.
+	maxMessageSize = maxUploadSize/3*4 + 64<<10
+)
+
+// thumbnailKinds are the folders an uploaded or agent thumbnail may go to.
+var thumbnailKinds = map[string]string{
+	"named_titles":  "Named_Titles",
+	"named_boxarts": "Named_Boxarts",
+	"named_snaps":   "Named_Snaps",
+	"named_logos":   "Named_Logos",
+}
+
+var errUploadTooLarge = fmt.Errorf("image is larger than %d MB", maxUploadSize>>20)
+
+// decodeThumbnail checks that r holds a PNG or JPEG image within the limits
+// and returns it encoded as PNG, which is what RetroArch reads.
+func decodeThumbnail(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, errUploadTooLarge
+	}
+	// размеры проверяем до полного декодирования
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("not a PNG or JPEG image: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxThumbnailSide || cfg.Height > maxThumbnailSide {
+		return nil, fmt.Errorf("image is %dx%d, at most %dx%d is allowed", cfg.Width, cfg.Height, maxThumbnailSide, maxThumbnailSide)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("broken image: %v", err)
+	}
+	if format == "png" {
+		return data, nil
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decodeDataURL decodes a thumbnail sent as a data: URL by the settings page.
+func decodeDataURL(dataURL string) ([]byte, error) {
+	_, encoded, ok := strings.Cut(dataURL, ",")
+	if !ok {
+		return nil, errors.New("invalid data URL")
+	}
+	if base64.StdEncoding.DecodedLen(len(encoded)) > maxUploadSize+2 {
+		return nil, errUploadTooLarge
+	}
+	return decodeThumbnail(base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded)))
+}
+
+// writeThumbnail stores a decoded thumbnail as
+// <root>/<system>/<kind folder>/<name>.png and returns its path relative to
+// root with forward slashes. System and name follow RetroArch's naming rules
+// and the file never ends up outside root.
+func writeThumbnail(root, system, kind, name string, data []byte) (string, error) {
+	folder, ok := thumbnailKinds[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown thumbnail type %q", kind)
+	}
+	if strings.TrimSpace(root) == "" {
+		return "", errors.New("thumbnails_path is not set")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	rel := filepath.Join(retroarch.ThumbnailName(system), folder, retroarch.ThumbnailName(name)+".png")
+	path := filepath.Join(root, rel)
+	if check, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(check) {
+		return "", fmt.Errorf("thumbnail path %s is outside %s", path, root)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	slog.Info("Saved thumbnail", "path", path)
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,496 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"WatchdogRetroArch/detection"
+	"WatchdogRetroArch/retroarch"
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/gorilla/websocket"
+)
+
+// client is one open WebSocket connection. The connection allows only one
+// writer at a time, and both the hub and the connection's own handler write.
+type client struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// screen and slot are guarded by hub.mu.
+	screen string
+	slot   string
+}
+
+// writeWait limits how long a client that stopped reading can hold up a
+// broadcast.
+const writeWait = 10 * time.Second
+
+func (c *client) write(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// hub tracks the open WebSocket connections and the screen each one shows.
+type hub struct {
+	mu      sync.Mutex
+	clients map[*websocket.Conn]*client
+}
+
+func newHub() *hub {
+	return &hub{clients: make(map[*websocket.Conn]*client)}
+}
+
+func (h *hub) add(conn *websocket.Conn) *client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := &client{conn: conn}
+	h.clients[conn] = c
+	return c
+}
+
+func (h *hub) remove(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, conn)
+}
+
+func (h *hub) register(conn *websocket.Conn, screen, slot string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.clients[conn]; ok {
+		c.screen, c.slot = screen, slot
+	}
+}
+
+// broadcast sends msg to every client on screen that shows slot, or to all of
+// them for "*". It writes without holding h.mu, so a slow client does not
+// stall the other hub calls. A client that cannot be written to is dropped
+// and its connection closed, which also ends its handler.
+func (h *hub) broadcast(screen, slot string, msg string) {
+	h.mu.Lock()
+	var targets []*client
+	for _, client := range h.clients {
+		if (client.screen == screen && client.slot == slot) || screen == "*" {
+			targets = append(targets, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range targets {
+		if err := client.write([]byte(msg)); err != nil {
+			slog.Warn("Error sending data", "err", err)
+			h.remove(client.conn)
+			if err := client.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("failed close conn", "err", err)
+			}
+		}
+	}
+}
+
+// screens counts open connections by screen.
+func (h *hub) screens() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make(map[string]int)
+	for _, client := range h.clients {
+		counts[client.screen]++
+	}
+	return counts
+}
+
+// closeAll says goodbye to every widget so browsers see a clean close
+// instead of a dropped connection.
+func (h *hub) closeAll() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		if err := conn.WriteControl(websocket.CloseMessage, msg, deadline); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			slog.Debug("Error sending close frame", "err", err)
+		}
+		if err := conn.Close(); err != nil {
+			slog.Debug("failed close conn", "err", err)
+		}
+		delete(h.clients, conn)
+	}
+}
+
+type SendData struct {
+	Type    string      `json:"type"`
+	Screen  string      `json:"screen"`
+	Payload interface{} `json:"payload"`
+}
+
+type OutgoingMessage struct {
+	Type    string      `json:"type"`
+	Screen  string      `json:"screen"`
+	Payload interface{} `json:"payload"`
+}
+
+func (s *Server) sendUpdate(screen, slot string, payload interface{}) {
+	msg := OutgoingMessage{
+		Type:    "update",
+		Screen:  screen,
+		Payload: payload,
+	}
+
+	jsonBytes, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Error encoding JSON", "err", err)
+		return
+	}
+
+	s.hub.broadcast(screen, slot, string(jsonBytes))
+}
+
+// handleEvent pushes tracker changes to the open pages.
+func (s *Server) handleEvent(ev tracker.Event) {
+	switch ev.Kind {
+	case tracker.GameStarted, tracker.GameChanged:
+		s.sendGame(ev)
+	case tracker.AgentChanged:
+		// та же игра, но картинки теперь из другого источника
+		previous := ev.PreviousState
+		if ev.State.Game != "" && previous.Game == ev.State.Game && previous.System == ev.State.System {
+			s.sendGame(ev)
+		}
+	case tracker.SlotChanged:
+		s.sendGame(ev)
+	case tracker.TemplatesChanged:
+		s.notifyTemplatesChanged()
+	}
+}
+
+// sendGame updates the widgets of the slot ev is about.
+func (s *Server) sendGame(ev tracker.Event) {
+	game, console, slot := ev.State.Game, ev.State.System, ev.Slot
+	icons := systemIcon(ev.Config, console)
+	s.sendUpdate("game", slot, map[string]string{
+		"game": game,
+	})
+
+	thumbnailPaths, thumbnailWidth, thumbnailHeight := s.thumbnailPaths(ev.Config, ev.State, retroarch.ThumbnailFolders(ev.Config.ThumbnailTypes))
+	// виджеты с ?type= берут свой список из Types
+	types := make(map[string][]string)
+	if ev.Config.EnableThumbnails && game != "" {
+		for _, t := range retroarch.ThumbnailTypes {
+			folder, _ := retroarch.ThumbnailFolder(t)
+			types[t] = s.findThumbnails(ev.Config, ev.State, []string{folder})
+		}
+	}
+	data := struct {
+		Game   string              `json:"game"`
+		Paths  []string            `json:"paths"`
+		Types  map[string][]string `json:"types"`
+		Width  string              `json:"width"`
+		Height string              `json:"height"`
+	}{
+		Game:   game,
+		Paths:  thumbnailPaths,
+		Types:  types,
+		Width:  thumbnailWidth,
+		Height: thumbnailHeight,
+	}
+	s.sendUpdate("system", slot, map[string]string{
+		"console": console,
+		"icon":    icons,
+	})
+
+	s.sendUpdate("all", slot, map[string]string{
+		"console": console,
+		"game":    game,
+		"icon":    icons,
+	})
+	s.sendUpdate("thumbnails", slot, data)
+}
+
+func (s *Server) notifyTemplatesChanged() {
+	msg, err := json.Marshal(SendData{Type: "refresh", Screen: "settings-games", Payload: true})
+	if err != nil {
+		slog.Error("Error encoding refresh message", "err", err)
+		return
+	}
+	s.hub.broadcast("settings-games", "", string(msg))
+}
+
+// NotifyReload asks every open page to reload itself.
+func (s *Server) NotifyReload() {
+	msg, err := json.Marshal(SendData{Type: "reload", Screen: "*", Payload: true})
+	if err != nil {
+		slog.Error("Error encoding reload message", "err", err)
+		return
+	}
+	s.hub.broadcast("*", "", string(msg))
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  10 * 1024 * 1024,
+	WriteBufferSize: 10 * 1024 * 1024,
+	CheckOrigin:     checkOrigin,
+}
+
+// uploads are the thumbnails one settings page uploaded for the template it
+// is about to save. Every connection keeps its own, already checked images,
+// so two open tabs never pick up each other's files.
+type uploads struct {
+	namedTitles  []byte
+	namedBoxarts []byte
+}
+
+// save checks a data URL sent for kind and keeps the image until the
+// template is saved.
+func (u *uploads) save(dataURL, kind string) error {
+	data, err := decodeDataURL(dataURL)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "named_titles":
+		u.namedTitles = data
+	case "named_boxarts":
+		u.namedBoxarts = data
+	default:
+		return fmt.Errorf("unknown thumbnail type %q", kind)
+	}
+	return nil
+}
+
+// adminOnly lists WebSocket requests that read or change the settings.
+var adminOnly = map[string]bool{
+	"gameTemplates": true,
+	"processes":     true,
+	"infoProcess":   true,
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// права проверяем один раз при подключении: cookie и заголовки есть
+	// только у запроса на обновление протокола
+	admin := s.isAdmin(r)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("Error upgrading WebSocket", "err", err)
+		return
+	}
+	conn.SetReadLimit(maxMessageSize)
+	var uploaded uploads
+	defer func() {
+		s.hub.remove(conn)
+		// соединение мог уже закрыть broadcast
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Warn("failed close conn", "err", err)
+		}
+	}()
+
+	// Инициализируем клиента сразу при подключении, Screen будет обновлен при регистрации
+	c := s.hub.add(conn)
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			slog.Debug("WebSocket disconnected", "err", err)
+			break
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(msg, &payload); err != nil {
+			slog.Warn("Invalid WebSocket message", "err", err)
+			continue
+		}
+		dataType, _ := payload["dataType"].(string)
+		if !admin && (payload["type"] == "saveData" || payload["type"] == "delete" || adminOnly[dataType]) {
+			slog.Warn("Rejected WebSocket message without admin token", "type", payload["type"], "dataType", dataType)
+			continue
+		}
+		switch payload["type"] {
+		case "register": // Регистрация клиента
+			screen, _ := payload["screen"].(string)
+			slot, _ := payload["slot"].(string)
+			s.hub.register(conn, screen, slot)
+		case "get_data": // Запрос данных
+			var data SendData
+			switch payload["dataType"] {
+			case "gameTemplates":
+				data = SendData{
+					Type:    "gameTemplates",
+					Screen:  "settings-games",
+					Payload: s.tracker.Templates(), // Отправляем список шаблонов игр
+				}
+			case "processes":
+				processes, _ := detection.ListProcesses(s.tracker.Config())
+				data = SendData{
+					Type:    "processes",
+					Screen:  "settings-games",
+					Payload: processes, // Отправляем список процессов
+				}
+			case "infoProcess":
+				info, _ := detection.ProcessDetails(payload["pid"])
+				data = SendData{
+					Type:    "infoProcess",
+					Screen:  "settings-games",
+					Payload: info, // Отправляем данные о процессе
+				}
+			}
+
+			response, err := json.Marshal(data)
+			if err != nil {
+				slog.Error("Error encoding JSON", "err", err)
+				continue
+			}
+
+			if err := c.write(response); err != nil {
+				slog.Warn("Error sending data", "err", err)
+			}
+		case "saveData":
+
+			// Обработка сохранения данных
+			switch payload["dataType"] {
+			case "saveFile":
+				fileData, _ := payload["fileData"].(string)
+				imgType, _ := payload["imgType"].(string)
+				if err := uploaded.save(fileData, imgType); err != nil {
+					slog.Warn("Rejected uploaded thumbnail", "type", imgType, "err", err)
+					s.sendUploadError(c, err)
+				}
+
+			case "saveProcess":
+				dataForm, _ := payload["dataForm"].(map[string]interface{})
+				processName, _ := dataForm["process_name_display"].(string)
+				windowTitle, _ := dataForm["window_title"].(string)
+				priorityStr, _ := dataForm["priority"].(string)
+				priority, _ := strconv.Atoi(priorityStr)
+				if err := s.saveProcessInfo(c, &uploaded, processName, windowTitle, priority); err != nil {
+					var fields validationError
+					if errors.As(err, &fields) {
+						slog.Warn("Template not saved", "process", processName, "errors", fields.describe())
+						s.sendTemplateError(c, fields)
+					} else {
+						slog.Error("Error saving process info", "err", err)
+					}
+				}
+				data := SendData{
+					Type:    "refresh",
+					Screen:  "settings-games",
+					Payload: true,
+				}
+				response, _ := json.Marshal(data)
+				if err := c.write(response); err != nil {
+					slog.Warn("Error sending data", "err", err)
+				}
+			}
+		case "delete":
+			// Обработка удаления данных
+			switch payload["dataType"] {
+			case "deleteGameTemplate":
+				processName, _ := payload["processName"].(string)
+				id, _ := payload["id"].(string)
+				err := s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+					return templates.Remove(list, id, processName), nil
+				})
+				if err != nil {
+					slog.Error("Error saving game templates", "err", err)
+				}
+				data := SendData{
+					Type:    "refresh",
+					Screen:  "settings-games",
+					Payload: true,
+				}
+				response, _ := json.Marshal(data)
+				if err := c.write(response); err != nil {
+					slog.Warn("Error sending data", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// saveProcessInfo adds a template for a Windows game picked on the
+// settings-games page, moving the uploaded thumbnails into thumbnails_path.
+func (s *Server) saveProcessInfo(c *client, uploaded *uploads, processName string, windowTitle string, priority int) error {
+	system := "Windows"
+	game := strings.TrimSuffix(processName, ".exe")
+	if processName == "retroarch.exe" {
+		return fmt.Errorf("retroarch.exe is not a valid process name")
+	}
+	tmpl := templates.Template{
+		ID:          templates.NewID(),
+		ProcessName: processName,
+		WindowTitle: windowTitle,
+		System:      system,
+		Game:        game,
+		Priority:    priority,
+	}
+	// проверяем до записи картинок, чтобы отклонённый шаблон не оставлял файлов
+	if fields := templates.Validate(&tmpl, s.tracker.Templates()); len(fields) > 0 {
+		*uploaded = uploads{}
+		return validationError(fields)
+	}
+	// файл называется по заголовку окна, как и раньше
+	name := tmpl.WindowTitle
+	if name == "" {
+		name = game
+	}
+	thumbnailsPath := s.tracker.Config().ThumbnailsPath
+
+	var newNamedTitles, newBoxArts string
+	var err error
+	if uploaded.namedTitles != nil {
+		newNamedTitles, err = writeThumbnail(thumbnailsPath, system, "named_titles", name, uploaded.namedTitles)
+		if err != nil {
+			slog.Error("Error saving Named_Titles", "err", err)
+			s.sendUploadError(c, err)
+		}
+	}
+	if uploaded.namedBoxarts != nil {
+		newBoxArts, err = writeThumbnail(thumbnailsPath, system, "named_boxarts", name, uploaded.namedBoxarts)
+		if err != nil {
+			slog.Error("Error saving Named_Boxarts", "err", err)
+			s.sendUploadError(c, err)
+		}
+	}
+	*uploaded = uploads{}
+	tmpl.NamedTitles = newNamedTitles
+	tmpl.NamedBoxarts = newBoxArts
+	return s.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		if fields := templates.Validate(&tmpl, list); len(fields) > 0 {
+			return nil, validationError(fields)
+		}
+		return append(list, tmpl), nil
+	})
+}
+
+// sendTemplateError tells the settings page why a template was not saved.
+func (s *Server) sendTemplateError(c *client, fields validationError) {
+	response, _ := json.Marshal(SendData{
+		Type:    "templateError",
+		Screen:  "settings-games",
+		Payload: fields.describe(),
+	})
+	if err := c.write(response); err != nil {
+		slog.Warn("Error sending data", "err", err)
+	}
+}
+
+// sendUploadError tells the settings page why a thumbnail was not saved.
+func (s *Server) sendUploadError(c *client, err error) {
+	response, _ := json.Marshal(SendData{
+		Type:    "uploadError",
+		Screen:  "settings-games",
+		Payload: err.Error(),
+	})
+	if err := c.write(response); err != nil {
+		slog.Warn("Error sending data", "err", err)
+	}
+}
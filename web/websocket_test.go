@@ -0,0 +1,302 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"WatchdogRetroArch/templates"
+	"WatchdogRetroArch/tracker"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsTimeout bounds how long a test waits for a message that should come.
+const wsTimeout = 5 * time.Second
+
+// wsClient is a widget or settings page connected to a test server. Messages
+// are read on their own goroutine, because a connection cannot be read again
+// after a read timed out.
+type wsClient struct {
+	conn     *websocket.Conn
+	messages chan received
+}
+
+// received is a message sent by the server, with the payload left raw.
+type received struct {
+	Type    string          `json:"type"`
+	Screen  string          `json:"screen"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (ts *testServer) dial(t *testing.T, header http.Header) *wsClient {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + "/startport"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	c := &wsClient{conn: conn, messages: make(chan received, 64)}
+	go func() {
+		defer close(c.messages)
+		for {
+			var msg received
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+func (c *wsClient) send(t *testing.T, msg map[string]any) {
+	t.Helper()
+	if err := c.conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the next message, or false if none came within d.
+func (c *wsClient) read(t *testing.T, d time.Duration) (received, bool) {
+	t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return msg, true
+	case <-time.After(d):
+		return received{}, false
+	}
+}
+
+// waitFor skips other messages until one of type typ for screen arrives.
+func (c *wsClient) waitFor(t *testing.T, typ, screen string) received {
+	t.Helper()
+	deadline := time.Now().Add(wsTimeout)
+	for time.Now().Before(deadline) {
+		msg, ok := c.read(t, time.Until(deadline))
+		if ok && msg.Type == typ && msg.Screen == screen {
+			return msg
+		}
+	}
+	t.Fatalf("no %s message for %s", typ, screen)
+	return received{}
+}
+
+// register shows screen and slot on c and waits until the server knows it:
+// messages of one connection are handled in order, so the answer to the
+// request after it comes once it is registered.
+func (c *wsClient) register(t *testing.T, screen, slot string) {
+	t.Helper()
+	c.send(t, map[string]any{"type": "register", "screen": screen, "slot": slot})
+	c.send(t, map[string]any{"type": "get_data", "dataType": "gameTemplates"})
+	c.waitFor(t, "gameTemplates", "settings-games")
+}
+
+func dataURL(data []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func TestWebSocketRequests(t *testing.T) {
+	saveProcess := func(process, title string) map[string]any {
+		return map[string]any{"type": "saveData", "dataType": "saveProcess", "dataForm": map[string]any{
+			"process_name_display": process, "window_title": title, "priority": "2",
+		}}
+	}
+	tests := []struct {
+		name     string
+		token    string // admin_token сервера; клиент его не отправляет
+		old      bool   // до запроса уже есть шаблон Old.exe
+		messages func(t *testing.T) []map[string]any
+		want     []string
+		check    func(t *testing.T, ts *testServer, replies []received)
+	}{
+		{
+			name: "template list",
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{{"type": "get_data", "dataType": "gameTemplates"}}
+			},
+			want: []string{"gameTemplates"},
+			check: func(t *testing.T, ts *testServer, replies []received) {
+				var list []templates.Template
+				if err := json.Unmarshal(replies[0].Payload, &list); err != nil {
+					t.Fatal(err)
+				}
+				if len(list) != 1 || list[0].ID != templates.RetroarchID {
+					t.Errorf("templates = %+v, want only the built-in one", list)
+				}
+			},
+		},
+		{
+			name: "template with thumbnail",
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{
+					{"type": "saveData", "dataType": "saveFile", "imgType": "named_titles", "fileData": dataURL(testPNG(t))},
+					saveProcess("Game.exe", "Game: Deluxe"),
+				}
+			},
+			want: []string{"refresh"},
+			check: func(t *testing.T, ts *testServer, replies []received) {
+				list := ts.tracker.Templates()
+				tmpl := list[len(list)-1]
+				if tmpl.ProcessName != "Game.exe" || tmpl.Priority != 2 || tmpl.NamedTitles != "Windows/Named_Titles/Game_ Deluxe.png" {
+					t.Fatalf("saved template = %+v", tmpl)
+				}
+				if _, err := os.Stat(filepath.Join(ts.tracker.Config().ThumbnailsPath, filepath.FromSlash(tmpl.NamedTitles))); err != nil {
+					t.Errorf("thumbnail not written: %v", err)
+				}
+			},
+		},
+		{
+			name: "broken thumbnail",
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{{"type": "saveData", "dataType": "saveFile", "imgType": "named_titles", "fileData": dataURL([]byte("not a png"))}}
+			},
+			want: []string{"uploadError"},
+		},
+		{
+			name: "invalid template",
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{saveProcess(`C:\Games\Game.exe`, "")}
+			},
+			want: []string{"templateError", "refresh"},
+			check: func(t *testing.T, ts *testServer, replies []received) {
+				if !strings.Contains(string(replies[0].Payload), "process_name") {
+					t.Errorf("error = %s, want it to name process_name", replies[0].Payload)
+				}
+				if n := len(ts.tracker.Templates()); n != 1 {
+					t.Errorf("%d templates after an invalid save", n)
+				}
+			},
+		},
+		{
+			name: "delete template",
+			old:  true,
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{{"type": "delete", "dataType": "deleteGameTemplate", "processName": "Old.exe"}}
+			},
+			want: []string{"refresh"},
+			check: func(t *testing.T, ts *testServer, replies []received) {
+				for _, tmpl := range ts.tracker.Templates() {
+					if tmpl.ProcessName == "Old.exe" {
+						t.Errorf("template not deleted: %+v", tmpl)
+					}
+				}
+			},
+		},
+		{
+			name:  "settings need the admin token",
+			token: "secret",
+			old:   true,
+			messages: func(t *testing.T) []map[string]any {
+				return []map[string]any{
+					{"type": "get_data", "dataType": "gameTemplates"},
+					saveProcess("Game.exe", ""),
+					{"type": "delete", "dataType": "deleteGameTemplate", "processName": "Old.exe"},
+				}
+			},
+			check: func(t *testing.T, ts *testServer, replies []received) {
+				if n := len(ts.tracker.Templates()); n != 2 {
+					t.Errorf("%d templates, want the two from before", n)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.AdminToken = tt.token
+			ts := newTestServer(t, cfg)
+			if tt.old {
+				err := ts.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+					return append(list, templates.Template{ID: templates.NewID(), ProcessName: "Old.exe"}), nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := ts.dial(t, nil)
+			for _, msg := range tt.messages(t) {
+				c.send(t, msg)
+			}
+			var replies []received
+			for range tt.want {
+				msg, ok := c.read(t, wsTimeout)
+				if !ok {
+					break
+				}
+				replies = append(replies, msg)
+			}
+			if extra, ok := c.read(t, 100*time.Millisecond); ok {
+				replies = append(replies, extra)
+			}
+			var types []string
+			for _, msg := range replies {
+				types = append(types, msg.Type)
+			}
+			if strings.Join(types, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("replies = %v, want %v", types, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, ts, replies)
+			}
+		})
+	}
+}
+
+func TestWebSocketBroadcast(t *testing.T) {
+	ts := newTestServer(t, testConfig(t))
+	game := ts.dial(t, nil)
+	game.register(t, "game", "")
+	left := ts.dial(t, nil)
+	left.register(t, "game", "left")
+	settings := ts.dial(t, nil)
+	settings.register(t, "settings-games", "")
+
+	gameOf := func(t *testing.T, msg received) string {
+		var payload map[string]string
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		return payload["game"]
+	}
+
+	ts.tracker.SetGame("Windows", "Doom")
+	if got := gameOf(t, game.waitFor(t, "update", "game")); got != "Doom" {
+		t.Errorf("default slot shows %q, want Doom", got)
+	}
+	if msg, ok := left.read(t, 200*time.Millisecond); ok {
+		t.Errorf("slot left got a message for the default slot: %+v", msg)
+	}
+
+	ts.tracker.SetSlot("left", tracker.State{Game: "Quake", System: "Windows"})
+	if got := gameOf(t, left.waitFor(t, "update", "game")); got != "Quake" {
+		t.Errorf("slot left shows %q, want Quake", got)
+	}
+	if msg, ok := game.read(t, 200*time.Millisecond); ok {
+		t.Errorf("default slot got a message for slot left: %+v", msg)
+	}
+
+	err := ts.tracker.UpdateTemplates(func(list []templates.Template) ([]templates.Template, error) {
+		return append(list, templates.Template{ID: templates.NewID(), ProcessName: "Doom.exe"}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.waitFor(t, "refresh", "settings-games")
+
+	ts.NotifyReload()
+	for _, c := range []*wsClient{game, left, settings} {
+		c.waitFor(t, "reload", "*")
+	}
+}